@@ -0,0 +1,120 @@
+/*
+The MIT License (MIT)
+
+Copyright (c) 2013-2014 winlin
+
+Permission is hereby granted, free of charge, to any person obtaining a copy of
+this software and associated documentation files (the "Software"), to deal in
+the Software without restriction, including without limitation the rights to
+use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+the Software, and to permit persons to whom the Software is furnished to do so,
+subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+*/
+
+package api
+
+import (
+    "io"
+    "fmt"
+    "net/http"
+    "encoding/json"
+    "github.com/cittu/go-srs/core"
+    "github.com/cittu/go-srs/config"
+)
+
+// the code of api response, 0 for success.
+const (
+    CodeSuccess = 0
+    CodeFailed = 1
+    CodeNotFound = 2
+)
+
+/**
+* create the handler of http api,
+* which serve the /api/v3/ for version, reload, summaries and statistic,
+* and the /metrics for prometheus.
+*/
+func NewHandler(logger core.Logger) http.Handler {
+    mux := http.NewServeMux()
+    h := &handler{logger: logger}
+
+    mux.HandleFunc("/api/v3/version", h.version)
+    mux.HandleFunc("/api/v3/reload", h.reload)
+    mux.HandleFunc("/api/v3/summaries", h.summaries)
+    mux.HandleFunc("/api/v3/vhosts", h.vhosts)
+    mux.HandleFunc("/api/v3/streams", h.streams)
+    mux.HandleFunc("/api/v3/streams/", h.streams)
+    mux.HandleFunc("/api/v3/clients", h.clients)
+    mux.HandleFunc("/api/v3/clients/", h.clients)
+    mux.HandleFunc("/metrics", h.metrics)
+
+    return mux
+}
+
+type handler struct {
+    logger core.Logger
+    cpu cpuSampler
+}
+
+// write the res in json, with the http status.
+func (h *handler) write(w http.ResponseWriter, status int, res map[string]interface{}) {
+    w.Header().Set("Server", fmt.Sprintf("CRS/%d.%d.%d",
+        core.Major, core.Minor, core.Revision))
+    w.Header().Set("Content-Type", "application/json")
+
+    data, err := json.Marshal(res)
+    if err != nil {
+        h.logger.Error("marshal json failed, err is %v", err)
+        w.WriteHeader(http.StatusInternalServerError)
+        return
+    }
+
+    w.WriteHeader(status)
+    io.WriteString(w, string(data))
+}
+
+// write the error response.
+func (h *handler) error(w http.ResponseWriter, status int, code int, err string) {
+    h.write(w, status, map[string]interface{}{
+        "code": code,
+        "error": err,
+    })
+}
+
+func (h *handler) version(w http.ResponseWriter, req *http.Request) {
+    h.write(w, http.StatusOK, map[string]interface{}{
+        "code": CodeSuccess,
+        "major": core.Major,
+        "minor": core.Minor,
+        "revision": core.Revision,
+    })
+}
+
+func (h *handler) reload(w http.ResponseWriter, req *http.Request) {
+    if req.Method != http.MethodPost && req.Method != http.MethodPut {
+        w.Header().Set("Allow", "POST, PUT")
+        h.error(w, http.StatusMethodNotAllowed, CodeFailed, "reload requires POST or PUT")
+        return
+    }
+
+    if err := config.Reload(); err != nil {
+        h.logger.Error("reload config by api failed, err is %v", err)
+        h.error(w, http.StatusInternalServerError, CodeFailed, err.Error())
+        return
+    }
+    h.logger.Trace("reload config by api success")
+
+    h.write(w, http.StatusOK, map[string]interface{}{
+        "code": CodeSuccess,
+    })
+}
@@ -0,0 +1,166 @@
+/*
+The MIT License (MIT)
+
+Copyright (c) 2013-2014 winlin
+
+Permission is hereby granted, free of charge, to any person obtaining a copy of
+this software and associated documentation files (the "Software"), to deal in
+the Software without restriction, including without limitation the rights to
+use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+the Software, and to permit persons to whom the Software is furnished to do so,
+subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+*/
+
+package api
+
+import (
+    "fmt"
+    "sort"
+    "bytes"
+    "strings"
+    "net/http"
+    "github.com/cittu/go-srs/protocol"
+    "github.com/cittu/go-srs/rtmp"
+)
+
+/**
+* the metrics in prometheus text exposition format,
+* @see https://prometheus.io/docs/instrumenting/exposition_formats/
+*/
+type metrics struct {
+    b bytes.Buffer
+}
+
+// write the HELP and TYPE of metric, the type is counter or gauge.
+func (m *metrics) describe(name, metricType, help string) {
+    fmt.Fprintf(&m.b, "# HELP %s %s\n", name, help)
+    fmt.Fprintf(&m.b, "# TYPE %s %s\n", name, metricType)
+}
+
+// write the sample of metric, the labels is the pairs of name and value.
+func (m *metrics) sample(name string, value interface{}, labels ...string) {
+    m.b.WriteString(name)
+    if len(labels) > 0 {
+        var pairs []string
+        for i := 0; i + 1 < len(labels); i += 2 {
+            pairs = append(pairs, fmt.Sprintf("%s=\"%s\"", labels[i], escapeLabel(labels[i + 1])))
+        }
+        m.b.WriteString("{" + strings.Join(pairs, ",") + "}")
+    }
+    fmt.Fprintf(&m.b, " %v\n", value)
+}
+
+var labelEscaper = strings.NewReplacer("\\", "\\\\", "\"", "\\\"", "\n", "\\n")
+
+func escapeLabel(v string) string {
+    return labelEscaper.Replace(v)
+}
+
+func (h *handler) metrics(w http.ResponseWriter, req *http.Request) {
+    m := &metrics{}
+
+    // the connections by client type.
+    types := map[string]int{
+        protocol.RtmpClientUnknown: 0,
+        protocol.RtmpClientPlay: 0,
+        protocol.RtmpClientFmlePublish: 0,
+        protocol.RtmpClientFlashPublish: 0,
+    }
+    for _,conn := range rtmp.Conns() {
+        clientType,_ := conn.ClientInfo()
+        types[clientType]++
+    }
+    m.describe("srs_connections", "gauge", "The current connections by client type.")
+    for _,t := range sortedKeys(types) {
+        m.sample("srs_connections", types[t], "type", t)
+    }
+
+    stat := protocol.ServerStat
+    failures := stat.HandshakeFailures()
+    m.describe("srs_handshake_failures_total", "counter", "The handshake failures by reason.")
+    for _,reason := range []string{protocol.HandshakeTimeout, protocol.HandshakeEOF,
+        protocol.HandshakePlainRequired, protocol.HandshakeIOError} {
+        m.sample("srs_handshake_failures_total", failures[reason], "reason", reason)
+    }
+
+    rejections := stat.Rejections()
+    keys := []protocol.RejectKey{}
+    for k,_ := range rejections {
+        keys = append(keys, k)
+    }
+    sort.Slice(keys, func(i, j int) bool {
+        return keys[i].Action < keys[j].Action || (keys[i].Action == keys[j].Action && keys[i].Reason < keys[j].Reason)
+    })
+    m.describe("srs_rejections_total", "counter", "The rejected clients by action and reason.")
+    for _,k := range keys {
+        m.sample("srs_rejections_total", rejections[k], "action", k.Action, "reason", k.Reason)
+    }
+
+    m.describe("srs_messages_received_total", "counter", "The rtmp messages received from clients.")
+    m.sample("srs_messages_received_total", stat.RecvMessages())
+    m.describe("srs_messages_sent_total", "counter", "The rtmp messages sent to clients.")
+    m.sample("srs_messages_sent_total", stat.SendMessages())
+    m.describe("srs_messages_dropped_total", "counter", "The messages dropped for channel full, source for EnqueueSourceMessage and pump for pumpMessage.")
+    m.sample("srs_messages_dropped_total", stat.DroppedSourceMessages(), "queue", "source")
+    m.sample("srs_messages_dropped_total", stat.DroppedPumpMessages(), "queue", "pump")
+
+    m.describe("srs_bytes_received_total", "counter", "The bytes received from clients.")
+    m.sample("srs_bytes_received_total", protocol.ServerKbps.RecvBytes())
+    m.describe("srs_bytes_sent_total", "counter", "The bytes sent to clients.")
+    m.sample("srs_bytes_sent_total", protocol.ServerKbps.SendBytes())
+
+    // the metrics of streams, labeled by vhost, app and stream.
+    sources := rtmp.Sources()
+    labels := func(source *rtmp.RtmpSource, v ...string) []string {
+        req := source.Request()
+        return append([]string{"vhost", req.Vhost, "app", req.App, "stream", req.Stream}, v...)
+    }
+    m.describe("srs_stream_bitrate_kbps", "gauge", "The bitrate of stream, recv from publisher and send to consumers.")
+    for _,source := range sources {
+        m.sample("srs_stream_bitrate_kbps", source.Kbps.RecvKbps(), labels(source, "direction", "recv")...)
+        m.sample("srs_stream_bitrate_kbps", source.Kbps.SendKbps(), labels(source, "direction", "send")...)
+    }
+    m.describe("srs_stream_fps", "gauge", "The video frames per second of stream.")
+    for _,source := range sources {
+        m.sample("srs_stream_fps", source.Fps(), labels(source)...)
+    }
+    m.describe("srs_stream_consumers", "gauge", "The consumers of stream.")
+    for _,source := range sources {
+        m.sample("srs_stream_consumers", source.ConsumerCount(), labels(source)...)
+    }
+    m.describe("srs_stream_gop_cache_messages", "gauge", "The messages in gop cache of stream.")
+    for _,source := range sources {
+        msgs,_ := source.GopCacheSize()
+        m.sample("srs_stream_gop_cache_messages", msgs, labels(source)...)
+    }
+    m.describe("srs_stream_gop_cache_bytes", "gauge", "The bytes in gop cache of stream.")
+    for _,source := range sources {
+        _,bytes := source.GopCacheSize()
+        m.sample("srs_stream_gop_cache_bytes", bytes, labels(source)...)
+    }
+    m.describe("srs_stream_consumer_queue_messages", "gauge", "The messages queued to send for all consumers of stream.")
+    for _,source := range sources {
+        m.sample("srs_stream_consumer_queue_messages", source.QueuedMessages(), labels(source)...)
+    }
+
+    w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+    w.Write(m.b.Bytes())
+}
+
+func sortedKeys(v map[string]int) (keys []string) {
+    for k,_ := range v {
+        keys = append(keys, k)
+    }
+    sort.Strings(keys)
+    return
+}
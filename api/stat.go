@@ -0,0 +1,294 @@
+/*
+The MIT License (MIT)
+
+Copyright (c) 2013-2014 winlin
+
+Permission is hereby granted, free of charge, to any person obtaining a copy of
+this software and associated documentation files (the "Software"), to deal in
+the Software without restriction, including without limitation the rights to
+use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+the Software, and to permit persons to whom the Software is furnished to do so,
+subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+*/
+
+package api
+
+import (
+    "time"
+    "strings"
+    "strconv"
+    "net/http"
+    "github.com/cittu/go-srs/config"
+    "github.com/cittu/go-srs/protocol"
+    "github.com/cittu/go-srs/rtmp"
+)
+
+// the seconds since the time.
+func uptime(t time.Time) int {
+    return int(time.Since(t) / time.Second)
+}
+
+func kbps(v *protocol.Kbps) map[string]interface{} {
+    return map[string]interface{}{
+        "recv": v.RecvKbps(),
+        "send": v.SendKbps(),
+    }
+}
+
+/**
+* parse the id in path, for example, 100 for /api/v3/streams/100,
+* @return the id and whether specified, error when id is invalid.
+*/
+func parseId(path, prefix string) (id int, ok bool, err error) {
+    v := strings.Trim(strings.TrimPrefix(path, prefix), "/")
+    if v == "" {
+        return
+    }
+    if id,err = strconv.Atoi(v); err != nil {
+        return
+    }
+    return id, true, nil
+}
+
+func streamInfo(source *rtmp.RtmpSource) map[string]interface{} {
+    req := source.Request()
+    v := map[string]interface{}{
+        "id": source.Id,
+        "name": req.Stream,
+        "vhost": req.Vhost,
+        "app": req.App,
+        "url": req.StreamUrl(),
+        "uptime": uptime(source.Created),
+        "consumers": source.ConsumerCount(),
+        "recv_bytes": source.Kbps.RecvBytes(),
+        "send_bytes": source.Kbps.SendBytes(),
+        "kbps": kbps(source.Kbps),
+        "fps": source.Fps(),
+    }
+
+    publish := map[string]interface{}{
+        "active": false,
+    }
+    if conn, publishTime := source.Publisher(); conn != nil {
+        publish["active"] = true
+        publish["cid"] = conn.SrsId
+        publish["ip"] = conn.Ip
+        publish["uptime"] = uptime(publishTime)
+    }
+    v["publish"] = publish
+
+    codec := source.Codec()
+    v["video"] = nil
+    if codec.HasVideo() {
+        video := map[string]interface{}{
+            "codec": rtmp.VideoCodecName(codec.VideoCodec),
+        }
+        if codec.VideoCodec == rtmp.FlvVideoCodecAVC {
+            video["profile"] = rtmp.AvcProfileName(codec.AvcProfile)
+            video["level"] = rtmp.AvcLevelName(codec.AvcLevel)
+        }
+        v["video"] = video
+    }
+    v["audio"] = nil
+    if codec.HasAudio() {
+        audio := map[string]interface{}{
+            "codec": rtmp.AudioCodecName(codec.AudioCodec),
+            "sample_rate": codec.SampleRate,
+            "channel": codec.Channels,
+        }
+        if codec.AudioCodec == rtmp.FlvAudioCodecAAC {
+            audio["profile"] = rtmp.AacObjectName(codec.AacObject)
+        }
+        v["audio"] = audio
+    }
+
+    return v
+}
+
+func clientInfo(conn *protocol.Conn) map[string]interface{} {
+    clientType, req := conn.ClientInfo()
+    v := map[string]interface{}{
+        "id": conn.SrsId,
+        "ip": conn.Ip,
+        "type": clientType,
+        "vhost": req.Vhost,
+        "app": req.App,
+        "stream": req.Stream,
+        "tcUrl": req.TcUrl,
+        "pageUrl": req.PageUrl,
+        "swfUrl": req.SwfUrl,
+        "publish": clientType == protocol.RtmpClientFmlePublish || clientType == protocol.RtmpClientFlashPublish,
+        "alive": uptime(conn.Created),
+        "recv_bytes": conn.Kbps.RecvBytes(),
+        "send_bytes": conn.Kbps.SendBytes(),
+        "kbps": kbps(conn.Kbps),
+    }
+
+    // the id of stream, 0 if not play or publish.
+    v["stream_id"] = 0
+    if clientType != protocol.RtmpClientUnknown {
+        if source := rtmp.FetchSource(&req); source != nil {
+            v["stream_id"] = source.Id
+        }
+    }
+
+    return v
+}
+
+func (h *handler) streams(w http.ResponseWriter, req *http.Request) {
+    id, ok, err := parseId(req.URL.Path, "/api/v3/streams")
+    if err != nil {
+        h.error(w, http.StatusBadRequest, CodeFailed, "invalid stream id")
+        return
+    }
+    if req.Method != http.MethodGet && req.Method != http.MethodDelete {
+        w.Header().Set("Allow", "GET, DELETE")
+        h.error(w, http.StatusMethodNotAllowed, CodeFailed, "streams requires GET or DELETE")
+        return
+    }
+    if !ok && req.Method == http.MethodDelete {
+        w.Header().Set("Allow", "GET")
+        h.error(w, http.StatusMethodNotAllowed, CodeFailed, "stream id required")
+        return
+    }
+
+    if !ok {
+        streams := []map[string]interface{}{}
+        for _,source := range rtmp.Sources() {
+            streams = append(streams, streamInfo(source))
+        }
+        h.write(w, http.StatusOK, map[string]interface{}{
+            "code": CodeSuccess,
+            "streams": streams,
+        })
+        return
+    }
+
+    for _,source := range rtmp.Sources() {
+        if source.Id != id {
+            continue
+        }
+
+        if req.Method == http.MethodDelete {
+            r := source.Request()
+            h.logger.Trace("stop stream %v by api", r.StreamUrl())
+            source.Kick()
+            h.write(w, http.StatusOK, map[string]interface{}{
+                "code": CodeSuccess,
+            })
+            return
+        }
+
+        h.write(w, http.StatusOK, map[string]interface{}{
+            "code": CodeSuccess,
+            "stream": streamInfo(source),
+        })
+        return
+    }
+    h.error(w, http.StatusNotFound, CodeNotFound, "stream not found")
+}
+
+func (h *handler) clients(w http.ResponseWriter, req *http.Request) {
+    id, ok, err := parseId(req.URL.Path, "/api/v3/clients")
+    if err != nil {
+        h.error(w, http.StatusBadRequest, CodeFailed, "invalid client id")
+        return
+    }
+    if req.Method != http.MethodGet && req.Method != http.MethodDelete {
+        w.Header().Set("Allow", "GET, DELETE")
+        h.error(w, http.StatusMethodNotAllowed, CodeFailed, "clients requires GET or DELETE")
+        return
+    }
+    if !ok && req.Method == http.MethodDelete {
+        w.Header().Set("Allow", "GET")
+        h.error(w, http.StatusMethodNotAllowed, CodeFailed, "client id required")
+        return
+    }
+
+    if !ok {
+        clients := []map[string]interface{}{}
+        for _,conn := range rtmp.Conns() {
+            clients = append(clients, clientInfo(conn))
+        }
+        h.write(w, http.StatusOK, map[string]interface{}{
+            "code": CodeSuccess,
+            "clients": clients,
+        })
+        return
+    }
+
+    for _,conn := range rtmp.Conns() {
+        if conn.SrsId != id {
+            continue
+        }
+
+        if req.Method == http.MethodDelete {
+            h.logger.Trace("kick client %v by api", conn.SrsId)
+            conn.Kick()
+            h.write(w, http.StatusOK, map[string]interface{}{
+                "code": CodeSuccess,
+            })
+            return
+        }
+
+        h.write(w, http.StatusOK, map[string]interface{}{
+            "code": CodeSuccess,
+            "client": clientInfo(conn),
+        })
+        return
+    }
+    h.error(w, http.StatusNotFound, CodeNotFound, "client not found")
+}
+
+func (h *handler) vhosts(w http.ResponseWriter, req *http.Request) {
+    conf := config.Get()
+    conns := rtmp.Conns()
+
+    vhosts := []map[string]interface{}{}
+    for _,d := range conf.Vhosts() {
+        name := d.Arg0()
+
+        // the clients of vhost, sum the bytes and kbps.
+        var clients, recvKbps, sendKbps int
+        var recvBytes, sendBytes int64
+        for _,conn := range conns {
+            if _, req := conn.ClientInfo(); req.Vhost != name {
+                continue
+            }
+            clients++
+            recvBytes += conn.Kbps.RecvBytes()
+            sendBytes += conn.Kbps.SendBytes()
+            recvKbps += conn.Kbps.RecvKbps()
+            sendKbps += conn.Kbps.SendKbps()
+        }
+
+        vhosts = append(vhosts, map[string]interface{}{
+            "name": name,
+            "enabled": conf.VhostEnabled(name),
+            "edge": conf.VhostIsEdge(name),
+            "streams": len(rtmp.VhostSources(name)),
+            "clients": clients,
+            "recv_bytes": recvBytes,
+            "send_bytes": sendBytes,
+            "kbps": map[string]interface{}{
+                "recv": recvKbps,
+                "send": sendKbps,
+            },
+        })
+    }
+
+    h.write(w, http.StatusOK, map[string]interface{}{
+        "code": CodeSuccess,
+        "vhosts": vhosts,
+    })
+}
@@ -0,0 +1,210 @@
+/*
+The MIT License (MIT)
+
+Copyright (c) 2013-2014 winlin
+
+Permission is hereby granted, free of charge, to any person obtaining a copy of
+this software and associated documentation files (the "Software"), to deal in
+the Software without restriction, including without limitation the rights to
+use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+the Software, and to permit persons to whom the Software is furnished to do so,
+subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+*/
+
+package api
+
+import (
+    "encoding/json"
+    "fmt"
+    "net"
+    "net/http"
+    "net/http/httptest"
+    "testing"
+    "time"
+    "github.com/cittu/go-srs/config"
+    "github.com/cittu/go-srs/protocol"
+    "github.com/cittu/go-srs/rtmp"
+)
+
+// load the default config, restore the previous when test done.
+func configForTest(t *testing.T) {
+    c,err := config.LoadDefault()
+    if err != nil {
+        t.Fatalf("load default config failed, err is %v", err)
+    }
+    prev := config.Get()
+    t.Cleanup(func(){
+        config.Set(prev)
+    })
+    config.Set(c)
+}
+
+// listen at a free port and connect to it, return the client connection.
+func dialForTest(t *testing.T) net.Conn {
+    ln,err := net.Listen("tcp", "127.0.0.1:0")
+    if err != nil {
+        t.Fatalf("listen failed, err is %v", err)
+    }
+    addr := ln.Addr().String()
+    ln.Close()
+
+    if err = rtmp.Listen([]string{addr}); err != nil {
+        t.Fatalf("listen at %v failed, err is %v", addr, err)
+    }
+    t.Cleanup(func(){
+        rtmp.Listen(nil)
+    })
+
+    c,err := net.Dial("tcp", addr)
+    if err != nil {
+        t.Fatalf("dial %v failed, err is %v", addr, err)
+    }
+    t.Cleanup(func(){
+        c.Close()
+    })
+
+    // wait for the server to accept it.
+    for i := 0; i < 100 && len(rtmp.Conns()) == 0; i++ {
+        time.Sleep(10 * time.Millisecond)
+    }
+    if len(rtmp.Conns()) != 1 {
+        t.Fatalf("server must accept the connection")
+    }
+    return c
+}
+
+// find a source which is never released, for the stream api.
+func sourceForTest(t *testing.T, stream string) *rtmp.RtmpSource {
+    req := &protocol.RtmpRequest{Vhost: "__defaultVhost__", App: "live", Stream: stream}
+    source,err := rtmp.FindSource(&protocol.Conn{}, req, rtmp.CreateLogger("test"))
+    if err != nil {
+        t.Fatalf("find source failed, err is %v", err)
+    }
+    return source
+}
+
+// serve the request by api, return the http status and the json response.
+func serveForTest(t *testing.T, method, path string) (status int, res map[string]interface{}) {
+    w := httptest.NewRecorder()
+    NewHandler(rtmp.CreateLogger("test")).ServeHTTP(w, httptest.NewRequest(method, path, nil))
+
+    if err := json.Unmarshal(w.Body.Bytes(), &res); err != nil {
+        t.Fatalf("%v %v invalid response %v, err is %v", method, path, w.Body.String(), err)
+    }
+    return w.Code, res
+}
+
+func TestApiStreams(t *testing.T) {
+    configForTest(t)
+    source := sourceForTest(t, "api")
+
+    status,res := serveForTest(t, http.MethodGet, "/api/v3/streams")
+    if status != http.StatusOK || res["code"] != float64(CodeSuccess) {
+        t.Fatalf("list streams failed, status=%v, res=%v", status, res)
+    }
+    found := false
+    for _,v := range res["streams"].([]interface{}) {
+        if v.(map[string]interface{})["id"] == float64(source.Id) {
+            found = true
+        }
+    }
+    if !found {
+        t.Errorf("list streams must contains %v, actual %v", source.Id, res["streams"])
+    }
+
+    status,res = serveForTest(t, http.MethodGet, fmt.Sprintf("/api/v3/streams/%v", source.Id))
+    if status != http.StatusOK {
+        t.Fatalf("get stream failed, status=%v, res=%v", status, res)
+    }
+    if v := res["stream"].(map[string]interface{}); v["name"] != "api" {
+        t.Errorf("get stream name invalid, actual %v", v["name"])
+    }
+
+    status,res = serveForTest(t, http.MethodGet, "/api/v3/streams/999999")
+    if status != http.StatusNotFound || res["code"] != float64(CodeNotFound) {
+        t.Errorf("get unknown stream must be not found, status=%v, res=%v", status, res)
+    }
+
+    status,res = serveForTest(t, http.MethodGet, "/api/v3/streams/abc")
+    if status != http.StatusBadRequest {
+        t.Errorf("get invalid stream id must be bad request, status=%v, res=%v", status, res)
+    }
+}
+
+func TestApiClients(t *testing.T) {
+    configForTest(t)
+    dialForTest(t)
+    id := rtmp.Conns()[0].SrsId
+
+    status,res := serveForTest(t, http.MethodGet, "/api/v3/clients")
+    if status != http.StatusOK {
+        t.Fatalf("list clients failed, status=%v, res=%v", status, res)
+    }
+    if v := res["clients"].([]interface{}); len(v) != 1 || v[0].(map[string]interface{})["id"] != float64(id) {
+        t.Errorf("list clients must contains %v, actual %v", id, v)
+    }
+
+    status,res = serveForTest(t, http.MethodGet, fmt.Sprintf("/api/v3/clients/%v", id))
+    if status != http.StatusOK || res["client"].(map[string]interface{})["id"] != float64(id) {
+        t.Errorf("get client failed, status=%v, res=%v", status, res)
+    }
+
+    status,res = serveForTest(t, http.MethodGet, "/api/v3/clients/999999")
+    if status != http.StatusNotFound || res["code"] != float64(CodeNotFound) {
+        t.Errorf("get unknown client must be not found, status=%v, res=%v", status, res)
+    }
+}
+
+func TestApiDelete(t *testing.T) {
+    configForTest(t)
+    c := dialForTest(t)
+    id := rtmp.Conns()[0].SrsId
+    source := sourceForTest(t, "delete")
+
+    // the id is required to delete.
+    for _,path := range []string{"/api/v3/streams", "/api/v3/clients"} {
+        if status,res := serveForTest(t, http.MethodDelete, path); status != http.StatusMethodNotAllowed {
+            t.Errorf("delete %v without id must not allowed, status=%v, res=%v", path, status, res)
+        }
+    }
+
+    // only GET and DELETE are allowed.
+    for _,method := range []string{http.MethodPost, http.MethodPut, http.MethodPatch} {
+        for _,path := range []string{"/api/v3/streams", fmt.Sprintf("/api/v3/clients/%v", id)} {
+            if status,res := serveForTest(t, method, path); status != http.StatusMethodNotAllowed {
+                t.Errorf("%v %v must not allowed, status=%v, res=%v", method, path, status, res)
+            }
+        }
+    }
+
+    if status,res := serveForTest(t, http.MethodDelete, "/api/v3/streams/999999"); status != http.StatusNotFound {
+        t.Errorf("delete unknown stream must be not found, status=%v, res=%v", status, res)
+    }
+    if status,res := serveForTest(t, http.MethodDelete, fmt.Sprintf("/api/v3/streams/%v", source.Id)); status != http.StatusOK {
+        t.Errorf("delete stream failed, status=%v, res=%v", status, res)
+    }
+
+    // the client is kicked and closed by server, which serve messages after handshake.
+    if err := protocol.NewRtmpClient(c, rtmp.CreateLogger("test")).Handshake(); err != nil {
+        t.Fatalf("handshake failed, err is %v", err)
+    }
+    if status,res := serveForTest(t, http.MethodDelete, fmt.Sprintf("/api/v3/clients/%v", id)); status != http.StatusOK {
+        t.Fatalf("delete client failed, status=%v, res=%v", status, res)
+    }
+    c.SetReadDeadline(time.Now().Add(3 * time.Second))
+    if _,err := c.Read(make([]byte, 1)); err == nil {
+        t.Errorf("client must be closed by server")
+    } else if ne,ok := err.(net.Error); ok && ne.Timeout() {
+        t.Errorf("client must be closed by server, err is %v", err)
+    }
+}
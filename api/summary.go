@@ -0,0 +1,244 @@
+/*
+The MIT License (MIT)
+
+Copyright (c) 2013-2014 winlin
+
+Permission is hereby granted, free of charge, to any person obtaining a copy of
+this software and associated documentation files (the "Software"), to deal in
+the Software without restriction, including without limitation the rights to
+use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+the Software, and to permit persons to whom the Software is furnished to do so,
+subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+*/
+
+package api
+
+import (
+    "os"
+    "fmt"
+    "sync"
+    "time"
+    "strings"
+    "strconv"
+    "runtime"
+    "net/http"
+    "io/ioutil"
+    "github.com/cittu/go-srs/protocol"
+    "github.com/cittu/go-srs/rtmp"
+)
+
+// the time the server started, for the uptime.
+var startTime = time.Now()
+
+// the clock ticks per second of /proc/self/stat, the USER_HZ is 100 on linux.
+const clockTicks = 100
+
+/**
+* the stat of process, read from /proc/self/stat,
+* @see: man 5 proc, /proc/[pid]/stat
+*/
+type procStat struct {
+    // the cpu time in ticks, in user and kernel mode.
+    utime int64
+    stime int64
+    threads int
+    // the resident set size in pages.
+    rss int64
+}
+
+func readProcStat() (v procStat, err error) {
+    var b []byte
+    if b,err = ioutil.ReadFile("/proc/self/stat"); err != nil {
+        return
+    }
+
+    // the comm maybe contains space, so parse the fields after the comm.
+    s := string(b)
+    fields := strings.Fields(s[strings.LastIndex(s, ")") + 1:])
+    if len(fields) < 22 {
+        return v, fmt.Errorf("invalid /proc/self/stat, fields=%v", len(fields))
+    }
+
+    // the fields start from the 3rd field state.
+    v.utime,_ = strconv.ParseInt(fields[11], 10, 64)
+    v.stime,_ = strconv.ParseInt(fields[12], 10, 64)
+    v.threads,_ = strconv.Atoi(fields[17])
+    v.rss,_ = strconv.ParseInt(fields[21], 10, 64)
+    return
+}
+
+// the load average in 1, 5 and 15 minutes, read from /proc/loadavg.
+func readLoadAvg() (v []float64, err error) {
+    var b []byte
+    if b,err = ioutil.ReadFile("/proc/loadavg"); err != nil {
+        return
+    }
+
+    fields := strings.Fields(string(b))
+    for i := 0; i < 3 && i < len(fields); i++ {
+        var load float64
+        if load,err = strconv.ParseFloat(fields[i], 64); err != nil {
+            return
+        }
+        v = append(v, load)
+    }
+    return
+}
+
+// the bytes of all network interfaces except the loopback, read from /proc/net/dev.
+func readNetDev() (recv, send int64, err error) {
+    var b []byte
+    if b,err = ioutil.ReadFile("/proc/net/dev"); err != nil {
+        return
+    }
+
+    // Inter-|   Receive                            |  Transmit
+    //  face |bytes    packets errs drop fifo frame compressed multicast|bytes ...
+    //    lo: 2776770   11307    0    0    0     0          0         0  2776770 ...
+    for _,line := range strings.Split(string(b), "\n") {
+        i := strings.Index(line, ":")
+        if i < 0 || strings.TrimSpace(line[:i]) == "lo" {
+            continue
+        }
+
+        fields := strings.Fields(line[i + 1:])
+        if len(fields) < 9 {
+            continue
+        }
+        r,_ := strconv.ParseInt(fields[0], 10, 64)
+        s,_ := strconv.ParseInt(fields[8], 10, 64)
+        recv, send = recv + r, send + s
+    }
+    return
+}
+
+// the number of open files, the entries of /proc/self/fd.
+func countFds() (n int, err error) {
+    var fds []os.FileInfo
+    if fds,err = ioutil.ReadDir("/proc/self/fd"); err != nil {
+        return
+    }
+    return len(fds), nil
+}
+
+/**
+* the cpu usage of process, the percent between two samples,
+* the first sample is the average since the server started.
+*/
+type cpuSampler struct {
+    locker sync.Mutex
+    sampleTime time.Time
+    sampleTicks int64
+}
+
+func (v *cpuSampler) percent(stat procStat) float64 {
+    v.locker.Lock()
+    defer v.locker.Unlock()
+
+    now, ticks := time.Now(), stat.utime + stat.stime
+    if v.sampleTime.IsZero() {
+        v.sampleTime = startTime
+    }
+
+    var percent float64
+    if d := now.Sub(v.sampleTime).Seconds(); d > 0 {
+        percent = float64(ticks - v.sampleTicks) / clockTicks / d * 100
+    }
+    v.sampleTime, v.sampleTicks = now, ticks
+    return percent
+}
+
+/**
+* the rejected clients, grouped by action then reason,
+* for example, {"connect":{"max_ip_connections":3}}.
+*/
+func rejections(stat *protocol.Stat) map[string]map[string]int64 {
+    v := map[string]map[string]int64{}
+    for k,n := range stat.Rejections() {
+        if _,ok := v[k.Action]; !ok {
+            v[k.Action] = map[string]int64{}
+        }
+        v[k.Action][k.Reason] = n
+    }
+    return v
+}
+
+func (h *handler) summaries(w http.ResponseWriter, req *http.Request) {
+    // the process stat, ignore the /proc not exists, for example, darwin.
+    self := map[string]interface{}{
+        "goroutines": runtime.NumGoroutine(),
+    }
+    if stat, err := readProcStat(); err == nil {
+        self["cpu_percent"] = h.cpu.percent(stat)
+        self["rss_kbytes"] = stat.rss * int64(os.Getpagesize()) / 1024
+        self["threads"] = stat.threads
+    }
+    if fds, err := countFds(); err == nil {
+        self["fds"] = fds
+    }
+
+    var ms runtime.MemStats
+    runtime.ReadMemStats(&ms)
+    self["gc"] = map[string]interface{}{
+        "num_gc": ms.NumGC,
+        "pause_total_ms": ms.PauseTotalNs / uint64(time.Millisecond),
+        "last_pause_us": ms.PauseNs[(ms.NumGC + 255) % 256] / uint64(time.Microsecond),
+        "heap_alloc": ms.HeapAlloc,
+        "heap_sys": ms.HeapSys,
+        "sys": ms.Sys,
+    }
+
+    system := map[string]interface{}{
+        "cpus": runtime.NumCPU(),
+    }
+    if load, err := readLoadAvg(); err == nil && len(load) == 3 {
+        system["load_1m"] = load[0]
+        system["load_5m"] = load[1]
+        system["load_15m"] = load[2]
+    }
+    if recv, send, err := readNetDev(); err == nil {
+        system["net_recv_bytes"] = recv
+        system["net_send_bytes"] = send
+    }
+
+    // the totals of server.
+    var publishers, players int
+    conns := rtmp.Conns()
+    for _,conn := range conns {
+        switch clientType,_ := conn.ClientInfo(); clientType {
+        case protocol.RtmpClientPlay:
+            players++
+        case protocol.RtmpClientFmlePublish, protocol.RtmpClientFlashPublish:
+            publishers++
+        }
+    }
+    server := map[string]interface{}{
+        "uptime": uptime(startTime),
+        "connections": len(conns),
+        "publishers": publishers,
+        "players": players,
+        "streams": len(rtmp.Sources()),
+        "recv_bytes": protocol.ServerKbps.RecvBytes(),
+        "send_bytes": protocol.ServerKbps.SendBytes(),
+        "kbps": kbps(protocol.ServerKbps),
+        "rejections": rejections(protocol.ServerStat),
+    }
+
+    h.write(w, http.StatusOK, map[string]interface{}{
+        "code": CodeSuccess,
+        "pid": os.Getpid(),
+        "self": self,
+        "system": system,
+        "server": server,
+    })
+}
@@ -0,0 +1,706 @@
+/*
+The MIT License (MIT)
+
+Copyright (c) 2013-2014 winlin
+
+Permission is hereby granted, free of charge, to any person obtaining a copy of
+this software and associated documentation files (the "Software"), to deal in
+the Software without restriction, including without limitation the rights to
+use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+the Software, and to permit persons to whom the Software is furnished to do so,
+subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+*/
+
+package config
+
+import (
+    "github.com/cittu/go-srs/core"
+    "fmt"
+    "io/ioutil"
+    "net"
+    "strconv"
+    "strings"
+    "sync"
+    "time"
+)
+
+const (
+    // the default config file, relative to the work dir.
+    DefaultConfigFile = "conf/srs.conf"
+    // the default vhost, which serve the client without vhost or not matched.
+    DefaultVhost = "__defaultVhost__"
+
+    // the default values when not configed.
+    DefaultMaxConnections = 1000
+    DefaultLogLevel = "trace"
+    DefaultLogFile = "./objs/srs.log"
+    DefaultTimeJitter = "full"
+    DefaultQueueLength = 1024
+    DefaultChunkSize = 60000
+    DefaultGracePeriod = 30
+    // the timeouts in ms.
+    DefaultHandshakeTimeout = 10000
+    DefaultConnectTimeout = 30000
+    DefaultPublishFirstPacketTimeout = 20000
+    DefaultPublishNormalTimeout = 5000
+    DefaultPlaySendTimeout = 30000
+    DefaultHttpHooksTimeout = 3000
+)
+
+// the events of http hooks, the directive name in http_hooks.
+var HttpHooksEvents = []string{"on_connect", "on_close", "on_publish", "on_unpublish", "on_play", "on_stop"}
+
+/**
+* the directive of config, for example,
+*       listen 1935;
+*       vhost __defaultVhost__ {
+*           gop_cache on;
+*       }
+* the directive listen with args [1935],
+* and the directive vhost with args [__defaultVhost__] and a child directive gop_cache.
+*/
+type Directive struct {
+    // the line of directive in config file, 0 for the root.
+    Line int
+    Name string
+    Args []string
+    Directives []*Directive
+}
+
+// get the first arg, empty string if no args.
+func (d *Directive) Arg0() string {
+    if d == nil || len(d.Args) == 0 {
+        return ""
+    }
+    return d.Args[0]
+}
+
+// get the args, nil if directive is nil.
+func (d *Directive) GetArgs() []string {
+    if d == nil {
+        return nil
+    }
+    return d.Args
+}
+
+// get the first child directive by name, nil if not found.
+func (d *Directive) Get(name string) *Directive {
+    if d == nil {
+        return nil
+    }
+    for _,v := range d.Directives {
+        if v.Name == name {
+            return v
+        }
+    }
+    return nil
+}
+
+// get the child directive by name and the first arg, nil if not found.
+func (d *Directive) GetWithArg0(name, arg0 string) *Directive {
+    if d == nil {
+        return nil
+    }
+    for _,v := range d.Directives {
+        if v.Name == name && v.Arg0() == arg0 {
+            return v
+        }
+    }
+    return nil
+}
+
+// get all child directives by name.
+func (d *Directive) GetAll(name string) (v []*Directive) {
+    if d == nil {
+        return
+    }
+    for _,c := range d.Directives {
+        if c.Name == name {
+            v = append(v, c)
+        }
+    }
+    return
+}
+
+// whether the directive equals to another, ignore the line.
+func (d *Directive) Equals(o *Directive) bool {
+    if d == nil || o == nil {
+        return d == o
+    }
+    if d.Name != o.Name || len(d.Args) != len(o.Args) || len(d.Directives) != len(o.Directives) {
+        return false
+    }
+    for i,v := range d.Args {
+        if v != o.Args[i] {
+            return false
+        }
+    }
+    for i,v := range d.Directives {
+        if !v.Equals(o.Directives[i]) {
+            return false
+        }
+    }
+    return true
+}
+
+/**
+* the config of server, parsed from config file.
+* @remark use the Get to get the current config, which maybe reloaded.
+*/
+type Config struct {
+    // the config file, empty if use the default config.
+    File string
+    Root *Directive
+}
+
+// create the default config, which only has the default vhost.
+func NewDefaultConfig() *Config {
+    return &Config{
+        Root: &Directive{
+            Directives: []*Directive{
+                &Directive{Name: "vhost", Args: []string{DefaultVhost}, Directives: []*Directive{}},
+            },
+        },
+    }
+}
+
+// load and parse the config file.
+func Load(file string) (c *Config, err error) {
+    var b []byte
+    if b,err = ioutil.ReadFile(file); err != nil {
+        return
+    }
+    return Parse(file, b)
+}
+
+// parse the config from bytes, the file is used for error message.
+func Parse(file string, b []byte) (c *Config, err error) {
+    var root *Directive
+    if root,err = parse(file, b); err != nil {
+        return
+    }
+
+    c = &Config{File: file, Root: root}
+    if err = c.apply(); err != nil {
+        return nil, err
+    }
+    return
+}
+
+// use the default config, with the overrides applied.
+func LoadDefault() (c *Config, err error) {
+    c = NewDefaultConfig()
+    if err = c.apply(); err != nil {
+        return nil, err
+    }
+    return
+}
+
+// the overrides from command line, applied to every loaded config.
+var overrides []*Directive
+var overridesLocker sync.Mutex
+
+/**
+* override the directive of config, for example, the command line options,
+* the name is the path of directive split by dot, for example, http_api.listen,
+* the overrides are applied when load or reload config.
+*/
+func SetOverride(name string, args ...string) {
+    overridesLocker.Lock()
+    defer overridesLocker.Unlock()
+
+    overrides = append(overrides, &Directive{Name: name, Args: args})
+}
+
+// apply the overrides then validate the config.
+func (c *Config) apply() (err error) {
+    overridesLocker.Lock()
+    defer overridesLocker.Unlock()
+
+    for _,o := range overrides {
+        parent := c.Root
+        names := strings.Split(o.Name, ".")
+        for _,name := range names[:len(names) - 1] {
+            d := parent.Get(name)
+            if d == nil {
+                d = &Directive{Name: name, Directives: []*Directive{}}
+                parent.Directives = append(parent.Directives, d)
+            }
+            parent = d
+        }
+
+        name := names[len(names) - 1]
+        if d := parent.Get(name); d != nil {
+            d.Args = o.Args
+        } else {
+            parent.Directives = append(parent.Directives, &Directive{Name: name, Args: o.Args})
+        }
+    }
+
+    return c.validate()
+}
+
+var current = NewDefaultConfig()
+var locker sync.RWMutex
+
+// get the current config, never be nil.
+func Get() *Config {
+    locker.RLock()
+    defer locker.RUnlock()
+    return current
+}
+
+// use the config as current config.
+func Set(c *Config) {
+    locker.Lock()
+    defer locker.Unlock()
+    current = c
+}
+
+// get the ports or addresses to listen, for example, [":1935", "127.0.0.1:1936"].
+func (c *Config) Listens() (v []string) {
+    d := c.Root.Get("listen")
+    if d == nil {
+        return []string{fmt.Sprintf(":%d", core.ListenRtmp)}
+    }
+    for _,arg := range d.Args {
+        v = append(v, listenAddr(arg))
+    }
+    return
+}
+
+// the max connections of server.
+func (c *Config) MaxConnections() int {
+    return c.getInt(c.Root.Get("max_connections"), DefaultMaxConnections)
+}
+
+// the max connections from each client ip, 0 for no limit.
+func (c *Config) MaxConnectionsPerIp() int {
+    return c.getInt(c.Root.Get("max_connections_per_ip"), 0)
+}
+
+// the max new connections per minute from each client ip, 0 for no limit.
+func (c *Config) IpConnectRate() int {
+    return c.getInt(c.Root.Get("ip_connect_rate"), 0)
+}
+
+// the max burst of new connections from each client ip, default to the rate.
+func (c *Config) IpConnectBurst() int {
+    return c.getInt(c.Root.Get("ip_connect_burst"), c.IpConnectRate())
+}
+
+// the cpus to use, the GOMAXPROCS.
+func (c *Config) Cpus() int {
+    return c.getInt(c.Root.Get("cpus"), core.Cpus)
+}
+
+// the global out chunk size, the default for vhost.
+func (c *Config) ChunkSize() int {
+    return c.getInt(c.Root.Get("chunk_size"), DefaultChunkSize)
+}
+
+// the grace period to wait for connections to quit when shutdown.
+func (c *Config) GracePeriod() time.Duration {
+    return time.Duration(c.getInt(c.Root.Get("grace_period"), DefaultGracePeriod)) * time.Second
+}
+
+// the timeout to complete the handshake, 0 for no timeout.
+func (c *Config) HandshakeTimeout() time.Duration {
+    return c.getMs(c.Root.Get("handshake_timeout"), DefaultHandshakeTimeout)
+}
+
+// the timeout from handshake done to client identified as play or publish, 0 for no timeout.
+func (c *Config) ConnectTimeout() time.Duration {
+    return c.getMs(c.Root.Get("connect_timeout"), DefaultConnectTimeout)
+}
+
+// the log level, info, trace, warn or error.
+func (c *Config) LogLevel() string {
+    if v := c.Root.Get("srs_log_level").Arg0(); v != "" {
+        return v
+    }
+    return DefaultLogLevel
+}
+
+/**
+* the tank to write log, console or file,
+* default to file when srs_log_file specified, otherwise console.
+*/
+func (c *Config) LogTank() string {
+    if v := c.Root.Get("srs_log_tank").Arg0(); v != "" {
+        return v
+    }
+    if c.Root.Get("srs_log_file") != nil {
+        return "file"
+    }
+    return "console"
+}
+
+// the log format, text or json.
+func (c *Config) LogFormat() string {
+    if v := c.Root.Get("srs_log_format").Arg0(); v != "" {
+        return v
+    }
+    return "text"
+}
+
+// the log file when log tank is file.
+func (c *Config) LogFile() string {
+    if v := c.Root.Get("srs_log_file").Arg0(); v != "" {
+        return v
+    }
+    return DefaultLogFile
+}
+
+// rotate the log file when exceed the size in bytes, 0 to disable.
+func (c *Config) LogRotateMaxSize() int64 {
+    return int64(c.getInt(c.Root.Get("srs_log_rotate").Get("max_size"), 0)) * 1024 * 1024
+}
+
+// rotate the log file when opened exceed the interval, 0 to disable.
+func (c *Config) LogRotateInterval() time.Duration {
+    return time.Duration(c.getInt(c.Root.Get("srs_log_rotate").Get("interval"), 0)) * time.Second
+}
+
+// the number of rotated log files to keep, 0 to keep all.
+func (c *Config) LogRotateKeep() int {
+    return c.getInt(c.Root.Get("srs_log_rotate").Get("keep"), 0)
+}
+
+// whether gzip the rotated log files.
+func (c *Config) LogRotateCompress() bool {
+    return c.getBool(c.Root.Get("srs_log_rotate").Get("compress"), false)
+}
+
+// the pid file, empty to not write pid.
+func (c *Config) Pid() string {
+    return c.Root.Get("pid").Arg0()
+}
+
+// whether the http api enabled, default to on.
+func (c *Config) HttpApiEnabled() bool {
+    return c.getBool(c.Root.Get("http_api").Get("enabled"), true)
+}
+
+// the address of http api to listen, for example, ":1986".
+func (c *Config) HttpApiListen() string {
+    if v := c.Root.Get("http_api").Get("listen").Arg0(); v != "" {
+        return listenAddr(v)
+    }
+    return fmt.Sprintf(":%d", core.ListenApi)
+}
+
+// get all vhosts.
+func (c *Config) Vhosts() []*Directive {
+    return c.Root.GetAll("vhost")
+}
+
+// get the vhost directive by name, nil if not found.
+func (c *Config) Vhost(vhost string) *Directive {
+    return c.Root.GetWithArg0("vhost", vhost)
+}
+
+/**
+* resolve the vhost of client to the configed vhost, in order:
+*       1. the vhost which name equals to host, case insensitive.
+*       2. the vhost which aliases contains the host.
+*       3. the wildcard vhost, for example, *.example.com, the longest matched.
+*       4. the default vhost __defaultVhost__.
+* @return the vhost directive, nil if not found.
+*/
+func (c *Config) ResolveVhost(host string) *Directive {
+    host = strings.ToLower(strings.TrimSpace(host))
+
+    for _,v := range c.Vhosts() {
+        if strings.ToLower(v.Arg0()) == host {
+            return v
+        }
+    }
+
+    for _,v := range c.Vhosts() {
+        for _,alias := range v.Get("aliases").GetArgs() {
+            if strings.ToLower(alias) == host {
+                return v
+            }
+        }
+    }
+
+    var matched *Directive
+    for _,v := range c.Vhosts() {
+        name := strings.ToLower(v.Arg0())
+        if !strings.HasPrefix(name, "*.") || !strings.HasSuffix(host, name[1:]) {
+            continue
+        }
+        if matched == nil || len(name) > len(matched.Arg0()) {
+            matched = v
+        }
+    }
+    if matched != nil {
+        return matched
+    }
+
+    return c.Vhost(DefaultVhost)
+}
+
+// whether the vhost is enabled, default to on.
+func (c *Config) VhostEnabled(vhost string) bool {
+    d := c.Vhost(vhost)
+    if d == nil {
+        return false
+    }
+    return c.getBool(d.Get("enabled"), true)
+}
+
+// whether the vhost is edge mode, default to origin.
+func (c *Config) VhostIsEdge(vhost string) bool {
+    return c.Vhost(vhost).Get("mode").Arg0() == "remote"
+}
+
+// the origin servers of edge, for example, ["127.0.0.1:1935"].
+func (c *Config) VhostOrigins(vhost string) (v []string) {
+    for _,origin := range c.Vhost(vhost).Get("origin").GetArgs() {
+        v = append(v, originAddr(origin))
+    }
+    return
+}
+
+// whether the edge traverse the connect to origin to authenticate, default to off.
+func (c *Config) VhostTokenTraverse(vhost string) bool {
+    return c.getBool(c.Vhost(vhost).Get("token_traverse"), false)
+}
+
+// whether the gop cache is enabled, default to on.
+func (c *Config) VhostGopCache(vhost string) bool {
+    return c.getBool(c.Vhost(vhost).Get("gop_cache"), true)
+}
+
+// the time jitter algorithm, full, zero or off.
+func (c *Config) VhostTimeJitter(vhost string) string {
+    if v := c.Vhost(vhost).Get("time_jitter").Arg0(); v != "" {
+        return v
+    }
+    return DefaultTimeJitter
+}
+
+// the out chunk size of vhost, use the global chunk size when not specified.
+func (c *Config) VhostChunkSize(vhost string) int {
+    return c.getInt(c.Vhost(vhost).Get("chunk_size"), c.ChunkSize())
+}
+
+// the timeout to wait for the first media packet of publisher, 0 for no timeout.
+func (c *Config) VhostPublishFirstPacketTimeout(vhost string) time.Duration {
+    return c.getMs(c.Vhost(vhost).Get("publish_1stpkt_timeout"), DefaultPublishFirstPacketTimeout)
+}
+
+// the timeout of publisher without media packet, 0 for no timeout.
+func (c *Config) VhostPublishNormalTimeout(vhost string) time.Duration {
+    return c.getMs(c.Vhost(vhost).Get("publish_normal_timeout"), DefaultPublishNormalTimeout)
+}
+
+// the timeout of player which stall to receive messages, 0 for no timeout.
+func (c *Config) VhostPlaySendTimeout(vhost string) time.Duration {
+    return c.getMs(c.Vhost(vhost).Get("play_send_timeout"), DefaultPlaySendTimeout)
+}
+
+/**
+* the allowed domains of referer(pageUrl) for action, connect, publish or play,
+* nil when disabled or not configed, which allow any referer.
+*/
+func (c *Config) VhostRefer(vhost, action string) []string {
+    d := c.Vhost(vhost).Get("refer")
+    if !c.getBool(d.Get("enabled"), false) {
+        return nil
+    }
+    return d.Get(action).GetArgs()
+}
+
+// whether the token auth of vhost enabled, default to off.
+func (c *Config) VhostTokenAuthEnabled(vhost string) bool {
+    return c.getBool(c.Vhost(vhost).Get("token_auth").Get("enabled"), false)
+}
+
+// the secret to sign the publish token, empty when disabled or not configed.
+func (c *Config) VhostPublishSecret(vhost string) string {
+    if !c.VhostTokenAuthEnabled(vhost) {
+        return ""
+    }
+    return c.Vhost(vhost).Get("token_auth").Get("publish_secret").Arg0()
+}
+
+// the secret to sign the play token, empty when disabled or not configed.
+func (c *Config) VhostPlaySecret(vhost string) string {
+    if !c.VhostTokenAuthEnabled(vhost) {
+        return ""
+    }
+    return c.Vhost(vhost).Get("token_auth").Get("play_secret").Arg0()
+}
+
+/**
+* the security rule of vhost, allow or deny the action from the networks,
+* for example, allow publish 10.0.0.0/8;
+*/
+type SecurityRule struct {
+    Allow bool
+    // the action, publish or play.
+    Action string
+    Nets []*net.IPNet
+}
+
+// whether the rule matches the action from ip.
+func (r *SecurityRule) Match(action string, ip net.IP) bool {
+    if r.Action != action {
+        return false
+    }
+    for _,n := range r.Nets {
+        if n.Contains(ip) {
+            return true
+        }
+    }
+    return false
+}
+
+/**
+* parse the address of security rule to network,
+* the address is all, ip or cidr, for example, 192.168.1.0/24.
+*/
+func parseSecurityNet(v string) (nets []*net.IPNet, err error) {
+    if v == "all" {
+        v4, v6 := &net.IPNet{IP: net.IPv4zero, Mask: net.CIDRMask(0, 32)}, &net.IPNet{IP: net.IPv6zero, Mask: net.CIDRMask(0, 128)}
+        return []*net.IPNet{v4, v6}, nil
+    }
+
+    if strings.Index(v, "/") < 0 {
+        ip := net.ParseIP(v)
+        if ip == nil {
+            return nil, fmt.Errorf("invalid ip %v", v)
+        }
+        if ip.To4() != nil {
+            return []*net.IPNet{&net.IPNet{IP: ip.To4(), Mask: net.CIDRMask(32, 32)}}, nil
+        }
+        return []*net.IPNet{&net.IPNet{IP: ip, Mask: net.CIDRMask(128, 128)}}, nil
+    }
+
+    var n *net.IPNet
+    if _,n,err = net.ParseCIDR(v); err != nil {
+        return
+    }
+    return []*net.IPNet{n}, nil
+}
+
+// parse the allow or deny directive to rule.
+func parseSecurityRule(d *Directive) (r *SecurityRule, err error) {
+    r = &SecurityRule{Allow: d.Name == "allow", Action: d.Arg0()}
+    if r.Action != "publish" && r.Action != "play" {
+        return nil, fmt.Errorf("invalid action %v, must be publish or play", r.Action)
+    }
+
+    for _,v := range d.Args[1:] {
+        var nets []*net.IPNet
+        if nets,err = parseSecurityNet(v); err != nil {
+            return
+        }
+        r.Nets = append(r.Nets, nets...)
+    }
+    return
+}
+
+/**
+* the security rules of vhost in order, nil when disabled,
+* the first matched rule is applied, and allow when no rule matched.
+*/
+func (c *Config) VhostSecurityRules(vhost string) (rules []*SecurityRule) {
+    d := c.Vhost(vhost).Get("security")
+    if !c.getBool(d.Get("enabled"), false) {
+        return
+    }
+
+    for _,v := range d.Directives {
+        if v.Name != "allow" && v.Name != "deny" {
+            continue
+        }
+        // the rules are validated, so never failed.
+        if r,err := parseSecurityRule(v); err == nil {
+            rules = append(rules, r)
+        }
+    }
+    return
+}
+
+// whether the http hooks of vhost enabled, default to off.
+func (c *Config) VhostHttpHooksEnabled(vhost string) bool {
+    return c.getBool(c.Vhost(vhost).Get("http_hooks").Get("enabled"), false)
+}
+
+// the urls of http hooks for event, for example, on_connect, nil when disabled.
+func (c *Config) VhostHttpHooks(vhost, event string) []string {
+    if !c.VhostHttpHooksEnabled(vhost) {
+        return nil
+    }
+    return c.Vhost(vhost).Get("http_hooks").Get(event).GetArgs()
+}
+
+// the timeout to request the http hooks, 0 for no timeout.
+func (c *Config) VhostHttpHooksTimeout(vhost string) time.Duration {
+    return c.getMs(c.Vhost(vhost).Get("http_hooks").Get("timeout"), DefaultHttpHooksTimeout)
+}
+
+// the max connections of vhost, 0 for no limit.
+func (c *Config) VhostMaxConnections(vhost string) int {
+    return c.getInt(c.Vhost(vhost).Get("max_connections"), 0)
+}
+
+// the max messages queued for consumer.
+func (c *Config) VhostQueueLength(vhost string) int {
+    return c.getInt(c.Vhost(vhost).Get("queue_length"), DefaultQueueLength)
+}
+
+// get the int value of directive, default value if not configed.
+// @remark the directive is validated, so never failed.
+func (c *Config) getInt(d *Directive, dv int) int {
+    if v,err := strconv.Atoi(d.Arg0()); err == nil {
+        return v
+    }
+    return dv
+}
+
+// get the duration of directive in ms, default value in ms if not configed.
+func (c *Config) getMs(d *Directive, dv int) time.Duration {
+    return time.Duration(c.getInt(d, dv)) * time.Millisecond
+}
+
+// get the bool value of directive, on or off, default value if not configed.
+func (c *Config) getBool(d *Directive, dv bool) bool {
+    switch d.Arg0() {
+    case "on":
+        return true
+    case "off":
+        return false
+    }
+    return dv
+}
+
+// append the default port to origin, for example, 127.0.0.1 to 127.0.0.1:1935.
+func originAddr(v string) string {
+    if _,_,err := net.SplitHostPort(v); err != nil {
+        return net.JoinHostPort(v, strconv.Itoa(core.SRS_CONSTS_RTMP_DEFAULT_PORT))
+    }
+    return v
+}
+
+// convert the listen port to address, for example, 1935 to :1935.
+func listenAddr(v string) string {
+    if strings.Index(v, ":") < 0 {
+        return ":" + v
+    }
+    return v
+}
@@ -0,0 +1,282 @@
+/*
+The MIT License (MIT)
+
+Copyright (c) 2013-2014 winlin
+
+Permission is hereby granted, free of charge, to any person obtaining a copy of
+this software and associated documentation files (the "Software"), to deal in
+the Software without restriction, including without limitation the rights to
+use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+the Software, and to permit persons to whom the Software is furnished to do so,
+subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+*/
+
+package config
+
+import (
+    "errors"
+    "io/ioutil"
+    "os"
+    "path/filepath"
+    "strings"
+    "testing"
+    "time"
+)
+
+func TestParseValid(t *testing.T) {
+    cases := []struct {
+        name string
+        conf string
+        check func(c *Config) bool
+    }{
+        {"empty file", ``, func(c *Config) bool {
+            return len(c.Vhosts()) == 0 && c.MaxConnections() == DefaultMaxConnections
+        }},
+        {"comments and spaces", "# comment\n\tlisten   1935 ;  # tail\r\n", func(c *Config) bool {
+            return len(c.Listens()) == 1 && c.Listens()[0] == ":1935"
+        }},
+        {"multiple listens", `listen 1935 127.0.0.1:1936;`, func(c *Config) bool {
+            v := c.Listens()
+            return len(v) == 2 && v[0] == ":1935" && v[1] == "127.0.0.1:1936"
+        }},
+        {"quoted args", `vhost "a b" { refer { enabled on; connect 'x.com' "y.com"; } }`, func(c *Config) bool {
+            v := c.VhostRefer("a b", "connect")
+            return c.Vhost("a b") != nil && len(v) == 2 && v[0] == "x.com" && v[1] == "y.com"
+        }},
+        {"nested blocks", "vhost a {\n http_hooks {\n enabled on;\n on_play http://127.0.0.1/a http://127.0.0.1/b;\n }\n}", func(c *Config) bool {
+            return c.VhostHttpHooksEnabled("a") && len(c.VhostHttpHooks("a", "on_play")) == 2
+        }},
+        {"vhost values", `vhost a { time_jitter zero; queue_length 10; gop_cache off; chunk_size 4096; play_send_timeout 0; }`, func(c *Config) bool {
+            return c.VhostTimeJitter("a") == "zero" && c.VhostQueueLength("a") == 10 && !c.VhostGopCache("a") &&
+                c.VhostChunkSize("a") == 4096 && c.VhostPlaySendTimeout("a") == 0
+        }},
+        {"resolve vhost", `vhost __defaultVhost__ {} vhost a { aliases b; } vhost *.c.com {} vhost *.x.c.com {}`, func(c *Config) bool {
+            return c.ResolveVhost("A").Arg0() == "a" && c.ResolveVhost("b").Arg0() == "a" &&
+                c.ResolveVhost("y.c.com").Arg0() == "*.c.com" && c.ResolveVhost("y.x.c.com").Arg0() == "*.x.c.com" &&
+                c.ResolveVhost("z.com").Arg0() == DefaultVhost
+        }},
+        {"edge origins", `vhost a { mode remote; origin 127.0.0.1 127.0.0.1:1936; token_traverse on; }`, func(c *Config) bool {
+            v := c.VhostOrigins("a")
+            return c.VhostIsEdge("a") && c.VhostTokenTraverse("a") && len(v) == 2 && v[0] == "127.0.0.1:1935" && v[1] == "127.0.0.1:1936"
+        }},
+    }
+
+    for _,tc := range cases {
+        c,err := Parse("t.conf", []byte(tc.conf))
+        if err != nil {
+            t.Errorf("%v: parse failed, err is %v", tc.name, err)
+            continue
+        }
+        if !tc.check(c) {
+            t.Errorf("%v: check failed", tc.name)
+        }
+    }
+}
+
+func TestParseErrors(t *testing.T) {
+    cases := []struct {
+        name string
+        conf string
+        line int
+        msg string
+    }{
+        // the lexer and parser.
+        {"unterminated quote", "listen 1935;\nvhost \"a {\n}", 2, "unterminated quoted string"},
+        {"unterminated block", "vhost a {\n gop_cache on;\n", 3, "unexpected end of file"},
+        {"unexpected block end", "listen 1935;\n}", 2, "unexpected \"}\""},
+        {"unexpected semicolon", "listen 1935;\n;", 2, "expecting directive name"},
+        {"unterminated directive", "listen 1935;\nmax_connections 10", 2, "is not terminated"},
+        // the spec.
+        {"unknown directive", "listen 1935;\nunknown 1;", 2, "unknown directive \"unknown\""},
+        {"unknown directive in block", "vhost a {\n\n unknown 1;\n}", 3, "unknown directive \"unknown\" in vhost"},
+        {"invalid args", "listen 1935;\nmax_connections 1 2;", 2, "invalid number of args"},
+        {"no args", "listen;", 1, "invalid number of args"},
+        {"integer required", "\nmax_connections many;", 2, "requires integer"},
+        {"bool required", "vhost a {\n gop_cache yes;\n}", 2, "requires on or off"},
+        {"no block", "listen 1935 {}", 1, "has no block"},
+        {"requires block", "listen 1935;\nvhost a;", 2, "requires block"},
+        // the validation.
+        {"invalid listen", "listen abc;", 1, "invalid listen"},
+        {"max connections", "\n\nmax_connections 0;", 3, "max_connections must be positive"},
+        {"negative ip connections", "max_connections_per_ip -1;", 1, "must not be negative"},
+        {"invalid log level", "listen 1935;\nsrs_log_level debug;", 2, "invalid srs_log_level"},
+        {"duplicated vhost", "vhost a {}\nvhost a {}", 2, "duplicated vhost a, previous at line 1"},
+        {"invalid mode", "vhost a {\n mode edge;\n}", 2, "invalid mode"},
+        {"invalid time jitter", "vhost a {\n time_jitter on;\n}", 2, "invalid time_jitter"},
+        {"chunk size range", "vhost a {\n\n chunk_size 100;\n}", 3, "chunk_size must in"},
+        {"negative timeout", "vhost a {\n publish_1stpkt_timeout -1;\n}", 2, "must not be negative"},
+        {"hook url", "vhost a {\n http_hooks {\n on_play ftp://a;\n }\n}", 3, "must be http or https"},
+        {"token traverse", "vhost a {\n token_traverse on;\n}", 2, "token_traverse requires"},
+    }
+
+    for _,tc := range cases {
+        _,err := Parse("t.conf", []byte(tc.conf))
+        if err == nil {
+            t.Errorf("%v: expect error", tc.name)
+            continue
+        }
+        ce,ok := err.(*configError)
+        if !ok {
+            t.Errorf("%v: expect config error, actual %v", tc.name, err)
+            continue
+        }
+        if ce.line != tc.line || !strings.Contains(ce.msg, tc.msg) {
+            t.Errorf("%v: expect line %v %q, actual %v", tc.name, tc.line, tc.msg, err)
+        }
+        if !strings.HasPrefix(err.Error(), "t.conf:") {
+            t.Errorf("%v: expect file in error, actual %v", tc.name, err)
+        }
+    }
+}
+
+func TestDefaultValues(t *testing.T) {
+    c,err := LoadDefault()
+    if err != nil {
+        t.Fatalf("load default failed, err is %v", err)
+    }
+
+    if v := c.MaxConnections(); v != 1000 {
+        t.Errorf("max_connections default 1000, actual %v", v)
+    }
+    if c.MaxConnectionsPerIp() != 0 || c.IpConnectRate() != 0 || c.IpConnectBurst() != 0 {
+        t.Errorf("ip limits default 0")
+    }
+    if v := c.Listens(); len(v) != 1 || v[0] != ":1935" {
+        t.Errorf("listen default :1935, actual %v", v)
+    }
+    if v := c.HandshakeTimeout(); v != DefaultHandshakeTimeout * time.Millisecond {
+        t.Errorf("handshake_timeout default %v, actual %v", DefaultHandshakeTimeout, v)
+    }
+    if v := c.ChunkSize(); v != DefaultChunkSize {
+        t.Errorf("chunk_size default %v, actual %v", DefaultChunkSize, v)
+    }
+    if v := c.LogLevel(); v != DefaultLogLevel {
+        t.Errorf("srs_log_level default %v, actual %v", DefaultLogLevel, v)
+    }
+
+    vhost := DefaultVhost
+    if !c.VhostEnabled(vhost) || c.VhostIsEdge(vhost) || c.VhostTokenTraverse(vhost) {
+        t.Errorf("default vhost must be enabled origin")
+    }
+    if c.VhostTimeJitter(vhost) != DefaultTimeJitter || c.VhostQueueLength(vhost) != DefaultQueueLength {
+        t.Errorf("default vhost jitter or queue length")
+    }
+    if c.VhostChunkSize(vhost) != c.ChunkSize() || c.VhostMaxConnections(vhost) != 0 {
+        t.Errorf("default vhost chunk size or max connections")
+    }
+    if v := c.VhostHttpHooksTimeout(vhost); v != DefaultHttpHooksTimeout * time.Millisecond {
+        t.Errorf("http hooks timeout default %v, actual %v", DefaultHttpHooksTimeout, v)
+    }
+}
+
+func TestOverrides(t *testing.T) {
+    defer func() {
+        overrides = nil
+    }()
+
+    SetOverride("max_connections", "10")
+    SetOverride("http_api.listen", "1987")
+    SetOverride("listen", "1936")
+
+    c,err := Parse("t.conf", []byte("listen 1935;\nmax_connections 100;\n"))
+    if err != nil {
+        t.Fatalf("parse failed, err is %v", err)
+    }
+    if v := c.MaxConnections(); v != 10 {
+        t.Errorf("max_connections override to 10, actual %v", v)
+    }
+    if v := c.HttpApiListen(); v != ":1987" {
+        t.Errorf("http_api.listen override to :1987, actual %v", v)
+    }
+    if v := c.Listens(); len(v) != 1 || v[0] != ":1936" {
+        t.Errorf("listen override to :1936, actual %v", v)
+    }
+
+    // the overrides are validated.
+    SetOverride("max_connections", "0")
+    if _,err = Parse("t.conf", []byte("")); err == nil {
+        t.Errorf("invalid override must fail")
+    }
+}
+
+// the reload handler which fails the listen, records the listens when notified.
+type mockReloadHandler struct {
+    listens [][]string
+    cpus int
+}
+
+func (h *mockReloadHandler) OnReloadListen() error {
+    h.listens = append(h.listens, Get().Listens())
+    if len(h.listens) == 1 {
+        return errors.New("mock listen failed")
+    }
+    return nil
+}
+func (h *mockReloadHandler) OnReloadCpus() error {
+    h.cpus++
+    return nil
+}
+func (h *mockReloadHandler) OnReloadHttpApi() error {
+    return nil
+}
+func (h *mockReloadHandler) OnReloadLogLevel() error {
+    return nil
+}
+func (h *mockReloadHandler) OnReloadLogFile() error {
+    return nil
+}
+func (h *mockReloadHandler) OnReloadVhost(vhost string) error {
+    return nil
+}
+
+func TestReloadRollback(t *testing.T) {
+    dir,err := ioutil.TempDir("", "srs")
+    if err != nil {
+        t.Fatalf("create temp dir failed, err is %v", err)
+    }
+    defer os.RemoveAll(dir)
+
+    file := filepath.Join(dir, "srs.conf")
+    if err = ioutil.WriteFile(file, []byte("listen 1935;\ncpus 1;\n"), 0644); err != nil {
+        t.Fatalf("write config failed, err is %v", err)
+    }
+    old,err := Load(file)
+    if err != nil {
+        t.Fatalf("load failed, err is %v", err)
+    }
+    defer Set(Get())
+    Set(old)
+
+    h := &mockReloadHandler{}
+    Subscribe(h)
+    defer Unsubscribe(h)
+
+    if err = ioutil.WriteFile(file, []byte("listen 1936;\ncpus 2;\n"), 0644); err != nil {
+        t.Fatalf("write config failed, err is %v", err)
+    }
+    if err = Reload(); err == nil {
+        t.Fatalf("reload must fail when handler failed")
+    }
+    if Get() != old {
+        t.Errorf("config must rollback to old")
+    }
+
+    // notified for the new listens, then reverted to the old.
+    if len(h.listens) != 2 || h.listens[0][0] != ":1936" || h.listens[1][0] != ":1935" {
+        t.Errorf("listens must revert, actual %v", h.listens)
+    }
+    // the revert notifies all changes, the cpus is applied by the old config.
+    if h.cpus != 1 || Get().Cpus() != 1 {
+        t.Errorf("cpus must revert, notified %v times", h.cpus)
+    }
+}
@@ -0,0 +1,501 @@
+/*
+The MIT License (MIT)
+
+Copyright (c) 2013-2014 winlin
+
+Permission is hereby granted, free of charge, to any person obtaining a copy of
+this software and associated documentation files (the "Software"), to deal in
+the Software without restriction, including without limitation the rights to
+use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+the Software, and to permit persons to whom the Software is furnished to do so,
+subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+*/
+
+package config
+
+import (
+    "github.com/cittu/go-srs/protocol"
+    "fmt"
+    "net"
+    "strconv"
+    "strings"
+)
+
+/**
+* the error of config, with the file and line.
+*/
+type configError struct {
+    file string
+    line int
+    msg string
+}
+
+func newConfigError(file string, line int, format string, v ...interface{}) *configError {
+    return &configError{
+        file: file,
+        line: line,
+        msg: fmt.Sprintf(format, v...),
+    }
+}
+
+func (ce *configError) Error() string {
+    return fmt.Sprintf("%v:%v: %v", ce.file, ce.line, ce.msg)
+}
+
+// the token type of config.
+const (
+    tokenWord = iota
+    tokenSemicolon
+    tokenBlockStart
+    tokenBlockEnd
+    tokenEof
+)
+
+type token struct {
+    kind int
+    line int
+    value string
+}
+
+/**
+* the lexer of config, nginx style, for example,
+*       # comment
+*       listen 1935;
+*       vhost __defaultVhost__ {
+*           gop_cache on;
+*       }
+* the arg can be quoted by " or ', for example, "a b".
+*/
+type lexer struct {
+    file string
+    b []byte
+    pos int
+    line int
+}
+
+func (l *lexer) next() (t token, err error) {
+    // skip the spaces and comments.
+    for l.pos < len(l.b) {
+        ch := l.b[l.pos]
+        if ch == '\n' {
+            l.line++
+        }
+        if ch == '#' {
+            for l.pos < len(l.b) && l.b[l.pos] != '\n' {
+                l.pos++
+            }
+            continue
+        }
+        if ch != ' ' && ch != '\t' && ch != '\r' && ch != '\n' {
+            break
+        }
+        l.pos++
+    }
+
+    t.line = l.line
+    if l.pos >= len(l.b) {
+        t.kind = tokenEof
+        return
+    }
+
+    switch ch := l.b[l.pos]; ch {
+    case ';':
+        l.pos++
+        t.kind = tokenSemicolon
+        return
+    case '{':
+        l.pos++
+        t.kind = tokenBlockStart
+        return
+    case '}':
+        l.pos++
+        t.kind = tokenBlockEnd
+        return
+    case '"', '\'':
+        l.pos++
+        start := l.pos
+        for l.pos < len(l.b) && l.b[l.pos] != ch {
+            if l.b[l.pos] == '\n' {
+                l.line++
+            }
+            l.pos++
+        }
+        if l.pos >= len(l.b) {
+            err = newConfigError(l.file, t.line, "unterminated quoted string")
+            return
+        }
+        t.kind = tokenWord
+        t.value = string(l.b[start:l.pos])
+        l.pos++
+        return
+    }
+
+    start := l.pos
+    for l.pos < len(l.b) {
+        ch := l.b[l.pos]
+        if ch == ' ' || ch == '\t' || ch == '\r' || ch == '\n' || ch == ';' || ch == '{' || ch == '}' || ch == '#' {
+            break
+        }
+        l.pos++
+    }
+    t.kind = tokenWord
+    t.value = string(l.b[start:l.pos])
+    return
+}
+
+// parse the config to directive tree.
+func parse(file string, b []byte) (root *Directive, err error) {
+    l := &lexer{file: file, b: b, line: 1}
+    root = &Directive{}
+    if err = parseBlock(l, root, false); err != nil {
+        return nil, err
+    }
+    return
+}
+
+// parse the child directives of parent, util the block end or eof.
+func parseBlock(l *lexer, parent *Directive, isBlock bool) (err error) {
+    for {
+        var t token
+        if t,err = l.next(); err != nil {
+            return
+        }
+
+        switch t.kind {
+        case tokenEof:
+            if isBlock {
+                return newConfigError(l.file, t.line, "unexpected end of file, expecting \"}\" for %v at line %v",
+                    parent.Name, parent.Line)
+            }
+            return
+        case tokenBlockEnd:
+            if !isBlock {
+                return newConfigError(l.file, t.line, "unexpected \"}\"")
+            }
+            return
+        case tokenSemicolon, tokenBlockStart:
+            return newConfigError(l.file, t.line, "unexpected \"%v\", expecting directive name", string(l.b[l.pos - 1]))
+        }
+
+        d := &Directive{Line: t.line, Name: t.value}
+        parent.Directives = append(parent.Directives, d)
+
+        // parse the args, util ; or {
+        for {
+            if t,err = l.next(); err != nil {
+                return
+            }
+            if t.kind == tokenWord {
+                d.Args = append(d.Args, t.value)
+                continue
+            }
+            if t.kind == tokenSemicolon {
+                break
+            }
+            if t.kind == tokenBlockStart {
+                d.Directives = []*Directive{}
+                if err = parseBlock(l, d, true); err != nil {
+                    return
+                }
+                break
+            }
+            return newConfigError(l.file, t.line, "directive \"%v\" is not terminated by \";\"", d.Name)
+        }
+    }
+}
+
+// the arg type of directive.
+const (
+    argString = iota
+    argInt
+    argBool
+    argBlock
+)
+
+/**
+* the spec of directive, to validate the config.
+*/
+type directiveSpec struct {
+    kind int
+    // the min and max args, max<0 for unlimited.
+    minArgs int
+    maxArgs int
+    // for block, the allowed child directives.
+    children map[string]*directiveSpec
+}
+
+// the spec of vhost directives.
+var vhostSpec = &directiveSpec{kind: argBlock, minArgs: 1, maxArgs: 1, children: map[string]*directiveSpec{
+    "enabled": &directiveSpec{kind: argBool, minArgs: 1, maxArgs: 1},
+    "aliases": &directiveSpec{kind: argString, minArgs: 1, maxArgs: -1},
+    "mode": &directiveSpec{kind: argString, minArgs: 1, maxArgs: 1},
+    "origin": &directiveSpec{kind: argString, minArgs: 1, maxArgs: -1},
+    "token_traverse": &directiveSpec{kind: argBool, minArgs: 1, maxArgs: 1},
+    "gop_cache": &directiveSpec{kind: argBool, minArgs: 1, maxArgs: 1},
+    "time_jitter": &directiveSpec{kind: argString, minArgs: 1, maxArgs: 1},
+    "queue_length": &directiveSpec{kind: argInt, minArgs: 1, maxArgs: 1},
+    "max_connections": &directiveSpec{kind: argInt, minArgs: 1, maxArgs: 1},
+    "chunk_size": &directiveSpec{kind: argInt, minArgs: 1, maxArgs: 1},
+    "publish_1stpkt_timeout": &directiveSpec{kind: argInt, minArgs: 1, maxArgs: 1},
+    "publish_normal_timeout": &directiveSpec{kind: argInt, minArgs: 1, maxArgs: 1},
+    "play_send_timeout": &directiveSpec{kind: argInt, minArgs: 1, maxArgs: 1},
+    "refer": &directiveSpec{kind: argBlock, children: map[string]*directiveSpec{
+        "enabled": &directiveSpec{kind: argBool, minArgs: 1, maxArgs: 1},
+        "connect": &directiveSpec{kind: argString, minArgs: 1, maxArgs: -1},
+        "publish": &directiveSpec{kind: argString, minArgs: 1, maxArgs: -1},
+        "play": &directiveSpec{kind: argString, minArgs: 1, maxArgs: -1},
+    }},
+    "security": &directiveSpec{kind: argBlock, children: map[string]*directiveSpec{
+        "enabled": &directiveSpec{kind: argBool, minArgs: 1, maxArgs: 1},
+        "allow": &directiveSpec{kind: argString, minArgs: 2, maxArgs: -1},
+        "deny": &directiveSpec{kind: argString, minArgs: 2, maxArgs: -1},
+    }},
+    "token_auth": &directiveSpec{kind: argBlock, children: map[string]*directiveSpec{
+        "enabled": &directiveSpec{kind: argBool, minArgs: 1, maxArgs: 1},
+        "publish_secret": &directiveSpec{kind: argString, minArgs: 1, maxArgs: 1},
+        "play_secret": &directiveSpec{kind: argString, minArgs: 1, maxArgs: 1},
+    }},
+    "http_hooks": &directiveSpec{kind: argBlock, children: map[string]*directiveSpec{
+        "enabled": &directiveSpec{kind: argBool, minArgs: 1, maxArgs: 1},
+        "timeout": &directiveSpec{kind: argInt, minArgs: 1, maxArgs: 1},
+        "on_connect": &directiveSpec{kind: argString, minArgs: 1, maxArgs: -1},
+        "on_close": &directiveSpec{kind: argString, minArgs: 1, maxArgs: -1},
+        "on_publish": &directiveSpec{kind: argString, minArgs: 1, maxArgs: -1},
+        "on_unpublish": &directiveSpec{kind: argString, minArgs: 1, maxArgs: -1},
+        "on_play": &directiveSpec{kind: argString, minArgs: 1, maxArgs: -1},
+        "on_stop": &directiveSpec{kind: argString, minArgs: 1, maxArgs: -1},
+    }},
+}}
+
+// the spec of root directives.
+var rootSpec = &directiveSpec{kind: argBlock, children: map[string]*directiveSpec{
+    "listen": &directiveSpec{kind: argString, minArgs: 1, maxArgs: -1},
+    "max_connections": &directiveSpec{kind: argInt, minArgs: 1, maxArgs: 1},
+    "max_connections_per_ip": &directiveSpec{kind: argInt, minArgs: 1, maxArgs: 1},
+    "ip_connect_rate": &directiveSpec{kind: argInt, minArgs: 1, maxArgs: 1},
+    "ip_connect_burst": &directiveSpec{kind: argInt, minArgs: 1, maxArgs: 1},
+    "cpus": &directiveSpec{kind: argInt, minArgs: 1, maxArgs: 1},
+    "chunk_size": &directiveSpec{kind: argInt, minArgs: 1, maxArgs: 1},
+    "srs_log_level": &directiveSpec{kind: argString, minArgs: 1, maxArgs: 1},
+    "srs_log_tank": &directiveSpec{kind: argString, minArgs: 1, maxArgs: 1},
+    "srs_log_format": &directiveSpec{kind: argString, minArgs: 1, maxArgs: 1},
+    "srs_log_file": &directiveSpec{kind: argString, minArgs: 1, maxArgs: 1},
+    "srs_log_rotate": &directiveSpec{kind: argBlock, children: map[string]*directiveSpec{
+        "max_size": &directiveSpec{kind: argInt, minArgs: 1, maxArgs: 1},
+        "interval": &directiveSpec{kind: argInt, minArgs: 1, maxArgs: 1},
+        "keep": &directiveSpec{kind: argInt, minArgs: 1, maxArgs: 1},
+        "compress": &directiveSpec{kind: argBool, minArgs: 1, maxArgs: 1},
+    }},
+    "pid": &directiveSpec{kind: argString, minArgs: 1, maxArgs: 1},
+    "grace_period": &directiveSpec{kind: argInt, minArgs: 1, maxArgs: 1},
+    "handshake_timeout": &directiveSpec{kind: argInt, minArgs: 1, maxArgs: 1},
+    "connect_timeout": &directiveSpec{kind: argInt, minArgs: 1, maxArgs: 1},
+    "http_api": &directiveSpec{kind: argBlock, children: map[string]*directiveSpec{
+        "enabled": &directiveSpec{kind: argBool, minArgs: 1, maxArgs: 1},
+        "listen": &directiveSpec{kind: argString, minArgs: 1, maxArgs: 1},
+    }},
+    "vhost": vhostSpec,
+}}
+
+// validate the config, return the error with line.
+func (c *Config) validate() (err error) {
+    if err = c.validateDirective(c.Root, rootSpec); err != nil {
+        return
+    }
+
+    // check the values.
+    for _,d := range c.Root.GetAll("listen") {
+        for _,v := range d.Args {
+            if port,err := strconv.Atoi(v[strings.LastIndex(v, ":") + 1:]); err != nil || port <= 0 || port > 65535 {
+                return newConfigError(c.File, d.Line, "invalid listen %v", v)
+            }
+        }
+    }
+    if d := c.Root.Get("max_connections"); d != nil && c.MaxConnections() <= 0 {
+        return newConfigError(c.File, d.Line, "max_connections must be positive, actual is %v", d.Arg0())
+    }
+    for _,name := range []string{"max_connections_per_ip", "ip_connect_rate", "ip_connect_burst"} {
+        if d := c.Root.Get(name); d != nil && c.getInt(d, 0) < 0 {
+            return newConfigError(c.File, d.Line, "%v must not be negative, actual is %v", name, d.Arg0())
+        }
+    }
+    if d := c.Root.Get("cpus"); d != nil && c.Cpus() <= 0 {
+        return newConfigError(c.File, d.Line, "cpus must be positive, actual is %v", d.Arg0())
+    }
+    if d := c.Root.Get("grace_period"); d != nil && c.GracePeriod() < 0 {
+        return newConfigError(c.File, d.Line, "grace_period must not be negative, actual is %v", d.Arg0())
+    }
+    if err = c.validateChunkSize(c.Root.Get("chunk_size")); err != nil {
+        return
+    }
+    for _,name := range []string{"handshake_timeout", "connect_timeout"} {
+        if err = c.validateTimeout(c.Root.Get(name)); err != nil {
+            return
+        }
+    }
+    if d := c.Root.Get("srs_log_level"); d != nil {
+        switch d.Arg0() {
+        case "info", "trace", "warn", "error":
+        default:
+            return newConfigError(c.File, d.Line, "invalid srs_log_level %v, must be info, trace, warn or error", d.Arg0())
+        }
+    }
+
+    if r := c.Root.Get("srs_log_rotate"); r != nil {
+        for _,name := range []string{"max_size", "interval", "keep"} {
+            if d := r.Get(name); d != nil && c.getInt(d, 0) < 0 {
+                return newConfigError(c.File, d.Line, "%v must not be negative, actual is %v", d.Name, d.Arg0())
+            }
+        }
+    }
+    if d := c.Root.Get("srs_log_format"); d != nil && d.Arg0() != "text" && d.Arg0() != "json" {
+        return newConfigError(c.File, d.Line, "invalid srs_log_format %v, must be text or json", d.Arg0())
+    }
+    if d := c.Root.Get("srs_log_tank"); d != nil && d.Arg0() != "console" && d.Arg0() != "file" {
+        return newConfigError(c.File, d.Line, "invalid srs_log_tank %v, must be console or file", d.Arg0())
+    }
+
+    vhosts := map[string]*Directive{}
+    for _,v := range c.Vhosts() {
+        if p,ok := vhosts[v.Arg0()]; ok {
+            return newConfigError(c.File, v.Line, "duplicated vhost %v, previous at line %v", v.Arg0(), p.Line)
+        }
+        vhosts[v.Arg0()] = v
+
+        if d := v.Get("mode"); d != nil && d.Arg0() != "remote" && d.Arg0() != "origin" {
+            return newConfigError(c.File, d.Line, "invalid mode %v, must be remote or origin", d.Arg0())
+        }
+        if d := v.Get("origin"); d != nil {
+            for _,origin := range d.Args {
+                if _,_,err := net.SplitHostPort(originAddr(origin)); err != nil {
+                    return newConfigError(c.File, d.Line, "invalid origin %v, %v", origin, err)
+                }
+            }
+        }
+        if d := v.Get("token_traverse"); d != nil && c.VhostTokenTraverse(v.Arg0()) {
+            if !c.VhostIsEdge(v.Arg0()) || len(c.VhostOrigins(v.Arg0())) == 0 {
+                return newConfigError(c.File, d.Line, "token_traverse requires mode remote and origin")
+            }
+        }
+        if d := v.Get("time_jitter"); d != nil {
+            switch d.Arg0() {
+            case "full", "zero", "off":
+            default:
+                return newConfigError(c.File, d.Line, "invalid time_jitter %v, must be full, zero or off", d.Arg0())
+            }
+        }
+        if d := v.Get("max_connections"); d != nil && c.getInt(d, 0) < 0 {
+            return newConfigError(c.File, d.Line, "max_connections must not be negative, actual is %v", d.Arg0())
+        }
+        if d := v.Get("queue_length"); d != nil && c.VhostQueueLength(v.Arg0()) <= 0 {
+            return newConfigError(c.File, d.Line, "queue_length must be positive, actual is %v", d.Arg0())
+        }
+        if err = c.validateChunkSize(v.Get("chunk_size")); err != nil {
+            return
+        }
+        for _,name := range []string{"publish_1stpkt_timeout", "publish_normal_timeout", "play_send_timeout"} {
+            if err = c.validateTimeout(v.Get(name)); err != nil {
+                return
+            }
+        }
+        if security := v.Get("security"); security != nil {
+            for _,d := range security.Directives {
+                if d.Name != "allow" && d.Name != "deny" {
+                    continue
+                }
+                if _,err := parseSecurityRule(d); err != nil {
+                    return newConfigError(c.File, d.Line, "invalid %v, %v", d.Name, err)
+                }
+            }
+        }
+        if hooks := v.Get("http_hooks"); hooks != nil {
+            if err = c.validateTimeout(hooks.Get("timeout")); err != nil {
+                return
+            }
+            for _,event := range HttpHooksEvents {
+                d := hooks.Get(event)
+                for _,u := range d.GetArgs() {
+                    if !strings.HasPrefix(u, "http://") && !strings.HasPrefix(u, "https://") {
+                        return newConfigError(c.File, d.Line, "invalid %v url %v, must be http or https", event, u)
+                    }
+                }
+            }
+        }
+    }
+
+    return
+}
+
+// the chunk size must in [SRS_CONSTS_RTMP_MIN_CHUNK_SIZE, SRS_CONSTS_RTMP_MAX_CHUNK_SIZE].
+func (c *Config) validateChunkSize(d *Directive) (err error) {
+    if d == nil {
+        return
+    }
+    if v := c.getInt(d, 0); v < protocol.SRS_CONSTS_RTMP_MIN_CHUNK_SIZE || v > protocol.SRS_CONSTS_RTMP_MAX_CHUNK_SIZE {
+        return newConfigError(c.File, d.Line, "chunk_size must in [%v, %v], actual is %v",
+            protocol.SRS_CONSTS_RTMP_MIN_CHUNK_SIZE, protocol.SRS_CONSTS_RTMP_MAX_CHUNK_SIZE, d.Arg0())
+    }
+    return
+}
+
+// the timeout in ms must not be negative, 0 to disable it.
+func (c *Config) validateTimeout(d *Directive) (err error) {
+    if d != nil && c.getInt(d, 0) < 0 {
+        return newConfigError(c.File, d.Line, "%v must not be negative, actual is %v", d.Name, d.Arg0())
+    }
+    return
+}
+
+// validate the directive and its children by spec.
+func (c *Config) validateDirective(d *Directive, spec *directiveSpec) (err error) {
+    if d.Name != "" {
+        if len(d.Args) < spec.minArgs || (spec.maxArgs >= 0 && len(d.Args) > spec.maxArgs) {
+            return newConfigError(c.File, d.Line, "invalid number of args for directive \"%v\"", d.Name)
+        }
+    }
+
+    for _,v := range d.Args {
+        switch spec.kind {
+        case argInt:
+            if _,err = strconv.Atoi(v); err != nil {
+                return newConfigError(c.File, d.Line, "directive \"%v\" requires integer, actual is %v", d.Name, v)
+            }
+        case argBool:
+            if v != "on" && v != "off" {
+                return newConfigError(c.File, d.Line, "directive \"%v\" requires on or off, actual is %v", d.Name, v)
+            }
+        }
+    }
+
+    // the parsed block is never nil, even empty.
+    if spec.kind != argBlock && d.Directives != nil {
+        return newConfigError(c.File, d.Line, "directive \"%v\" has no block", d.Name)
+    }
+    if spec.kind == argBlock && d.Name != "" && d.Directives == nil {
+        return newConfigError(c.File, d.Line, "directive \"%v\" requires block", d.Name)
+    }
+
+    for _,v := range d.Directives {
+        child,ok := spec.children[v.Name]
+        if !ok {
+            if d.Name == "" {
+                return newConfigError(c.File, v.Line, "unknown directive \"%v\"", v.Name)
+            }
+            return newConfigError(c.File, v.Line, "unknown directive \"%v\" in %v", v.Name, d.Name)
+        }
+        if err = c.validateDirective(v, child); err != nil {
+            return
+        }
+    }
+    return
+}
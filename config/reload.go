@@ -0,0 +1,195 @@
+/*
+The MIT License (MIT)
+
+Copyright (c) 2013-2014 winlin
+
+Permission is hereby granted, free of charge, to any person obtaining a copy of
+this software and associated documentation files (the "Software"), to deal in
+the Software without restriction, including without limitation the rights to
+use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+the Software, and to permit persons to whom the Software is furnished to do so,
+subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+*/
+
+package config
+
+import (
+    "errors"
+    "sync"
+)
+
+var ConfigNoFile = errors.New("no config file to reload")
+
+/**
+* the handler to process the reload event,
+* the config is already changed when notified, use Get to get the new config.
+* @remark when any handler failed, the old config is restored and the handlers
+*       are notified again to revert the changes.
+*/
+type ReloadHandler interface {
+    // when the listen ports changed.
+    OnReloadListen() error
+    // when the cpus changed.
+    OnReloadCpus() error
+    // when the http_api changed, which requires restart.
+    OnReloadHttpApi() error
+    // when the log level changed.
+    OnReloadLogLevel() error
+    // when the log tank, file, rotate or format changed.
+    OnReloadLogFile() error
+    // when the vhost added, removed or changed.
+    OnReloadVhost(vhost string) error
+}
+
+var handlers []ReloadHandler
+var handlersLocker sync.Mutex
+
+// serialize the reload, for the SIGHUP and api may reload at the same time.
+var reloadLocker sync.Mutex
+
+// subscribe the reload event.
+func Subscribe(h ReloadHandler) {
+    handlersLocker.Lock()
+    defer handlersLocker.Unlock()
+
+    handlers = append(handlers, h)
+}
+
+// unsubscribe the reload event.
+func Unsubscribe(h ReloadHandler) {
+    handlersLocker.Lock()
+    defer handlersLocker.Unlock()
+
+    for i,v := range handlers {
+        if v == h {
+            handlers = append(handlers[:i], handlers[i + 1:]...)
+            return
+        }
+    }
+}
+
+/**
+* reload the config file of current config,
+* apply the new config when it's valid, and notify the handlers for the changes.
+* @remark rollback to the old config when any handler failed.
+*/
+func Reload() (err error) {
+    reloadLocker.Lock()
+    defer reloadLocker.Unlock()
+
+    old := Get()
+    if old.File == "" {
+        return ConfigNoFile
+    }
+
+    var c *Config
+    if c,err = Load(old.File); err != nil {
+        return
+    }
+    Set(c)
+
+    if err = notify(old, c); err != nil {
+        // restore the old config, and revert the applied changes,
+        // ignore the error of revert, the original error is returned.
+        Set(old)
+        notify(c, old)
+        return
+    }
+    return
+}
+
+// diff the old and new config, notify the handlers for each change.
+func notify(old, c *Config) (err error) {
+    handlersLocker.Lock()
+    defer handlersLocker.Unlock()
+
+    if !equalsStrings(old.Listens(), c.Listens()) {
+        for _,h := range handlers {
+            if err = h.OnReloadListen(); err != nil {
+                return
+            }
+        }
+    }
+
+    if old.Cpus() != c.Cpus() {
+        for _,h := range handlers {
+            if err = h.OnReloadCpus(); err != nil {
+                return
+            }
+        }
+    }
+
+    if !old.Root.Get("http_api").Equals(c.Root.Get("http_api")) {
+        for _,h := range handlers {
+            if err = h.OnReloadHttpApi(); err != nil {
+                return
+            }
+        }
+    }
+
+    if old.LogLevel() != c.LogLevel() {
+        for _,h := range handlers {
+            if err = h.OnReloadLogLevel(); err != nil {
+                return
+            }
+        }
+    }
+
+    if old.LogTank() != c.LogTank() || old.LogFile() != c.LogFile() || old.LogFormat() != c.LogFormat() ||
+        !old.Root.Get("srs_log_rotate").Equals(c.Root.Get("srs_log_rotate")) {
+        for _,h := range handlers {
+            if err = h.OnReloadLogFile(); err != nil {
+                return
+            }
+        }
+    }
+
+    // the added, removed or changed vhosts.
+    vhosts := []string{}
+    for _,v := range append(old.Vhosts(), c.Vhosts()...) {
+        vhost := v.Arg0()
+        if !old.Vhost(vhost).Equals(c.Vhost(vhost)) && !containsString(vhosts, vhost) {
+            vhosts = append(vhosts, vhost)
+        }
+    }
+    for _,vhost := range vhosts {
+        for _,h := range handlers {
+            if err = h.OnReloadVhost(vhost); err != nil {
+                return
+            }
+        }
+    }
+
+    return
+}
+
+func equalsStrings(a, b []string) bool {
+    if len(a) != len(b) {
+        return false
+    }
+    for i,v := range a {
+        if v != b[i] {
+            return false
+        }
+    }
+    return true
+}
+
+func containsString(a []string, v string) bool {
+    for _,e := range a {
+        if e == v {
+            return true
+        }
+    }
+    return false
+}
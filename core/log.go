@@ -37,6 +37,9 @@ type Logger interface {
     Warn(format string, v ...interface{})
     Error(format string, v ...interface{})
 
+    // attach the context field to the logs, for example, the vhost of connection.
+    SetField(name string, value interface{})
+
     // log.Logger service
     Printf(format string, v ...interface{})
     Print(v ...interface{})
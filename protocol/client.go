@@ -0,0 +1,125 @@
+/*
+The MIT License (MIT)
+
+Copyright (c) 2013-2014 winlin
+
+Permission is hereby granted, free of charge, to any person obtaining a copy of
+this software and associated documentation files (the "Software"), to deal in
+the Software without restriction, including without limitation the rights to
+use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+the Software, and to permit persons to whom the Software is furnished to do so,
+subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+*/
+
+package protocol
+
+import (
+    "io"
+    "bytes"
+    "errors"
+    "math/rand"
+    "time"
+    "github.com/cittu/go-srs/core"
+)
+
+var RtmpConnectRejected = errors.New("connect app rejected")
+
+/**
+* the rtmp client, to connect app of server as client,
+* for example, the edge connect to origin.
+*/
+type RtmpClient struct {
+    IoRw io.ReadWriter
+    Logger core.Logger
+    Protocol *Protocol
+    Rand *rand.Rand
+}
+
+func NewRtmpClient(iorw io.ReadWriter, logger core.Logger) *RtmpClient {
+    return &RtmpClient{
+        IoRw: iorw,
+        Logger: logger,
+        Protocol: NewProtocol(iorw, logger),
+        Rand: rand.New(rand.NewSource(time.Now().UnixNano())),
+    }
+}
+
+func (c *RtmpClient) Handshake() (err error) {
+    hs := &SimpleHandshake{}
+    return hs.WithServer(c.IoRw, c.Rand, c.Logger)
+}
+
+/**
+* connect app of server by the request, with the tcUrl, pageUrl, swfUrl and args,
+* wait for the _result or _error of server.
+* @return RtmpConnectRejected and the description when server rejected.
+*/
+func (c *RtmpClient) ConnectApp(req *RtmpRequest) (description string, err error) {
+    pkt := NewRtmpConnectAppPacket().(*RtmpConnectAppPacket)
+    pkt.CommandName = Amf0String(RTMP_AMF0_COMMAND_CONNECT)
+    pkt.TransactionId = Amf0Number(1.0)
+    pkt.CommandObject.Set("app", Amf0String(req.App))
+    pkt.CommandObject.Set("tcUrl", Amf0String(req.TcUrl))
+    if req.PageUrl != "" {
+        pkt.CommandObject.Set("pageUrl", Amf0String(req.PageUrl))
+    }
+    if req.SwfUrl != "" {
+        pkt.CommandObject.Set("swfUrl", Amf0String(req.SwfUrl))
+    }
+    pkt.CommandObject.Set("objectEncoding", Amf0Number(req.ObjectEncoding))
+    pkt.Arguments = req.Args
+
+    var msg *RtmpMessage
+    if msg,err = c.Protocol.EncodeMessage(pkt, 0); err != nil {
+        c.Logger.Error("encode connect app failed, err is %v", err)
+        return
+    }
+    if err = c.Protocol.SendMessage(msg); err != nil {
+        c.Logger.Error("send connect app failed, err is %v", err)
+        return
+    }
+    c.Logger.Info("send connect app ok, tcUrl=%v", req.TcUrl)
+
+    // ignore the messages until the response of connect app.
+    for {
+        if msg,err = c.Protocol.PumpMessage(); err != nil {
+            c.Logger.Error("recv connect app response failed, err is %v", err)
+            return
+        }
+        if msg == nil || !msg.Header.IsAmf0Command() {
+            continue
+        }
+
+        var command Amf0String
+        if command,err = DecodeAmf0String(bytes.NewBuffer(msg.Payload)); err != nil {
+            c.Logger.Error("decode command name failed, err is %v", err)
+            return
+        }
+
+        switch command {
+        case RTMP_AMF0_COMMAND_RESULT:
+            c.Logger.Info("connect app accepted")
+            return
+        case RTMP_AMF0_COMMAND_ERROR:
+            res := NewRtmpOnStatusCallPacket().(*RtmpOnStatusCallPacket)
+            if err := res.Decode(bytes.NewBuffer(msg.Payload), c.Logger); err == nil {
+                if v,ok := res.Data.GetString(StatusDescription); ok {
+                    description = string(v)
+                }
+            }
+            c.Logger.Info("connect app rejected, description=%v", description)
+            return description, RtmpConnectRejected
+        }
+        c.Logger.Info("ignore command %v", command)
+    }
+}
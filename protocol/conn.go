@@ -29,6 +29,8 @@ import (
 	"time"
 	"runtime"
 	"io"
+	"sync"
+	"sync/atomic"
 	"errors"
 	"github.com/cittu/go-srs/core"
 	"fmt"
@@ -36,12 +38,28 @@ import (
 )
 
 var RtmpInChannelMsg = errors.New("put msg to channel failed")
+var RtmpOutChannelFull = errors.New("outgoing channel full")
 var RtmpControlRepublish = errors.New("encoder republish stream")
+var RtmpConnClosed = errors.New("rtmp connection closed")
+var RtmpConnTimeout = errors.New("rtmp connection timeout")
+var RtmpConnKicked = errors.New("rtmp connection kicked")
+
+// the timeout to flush the queued messages when connection quit.
+const RtmpFlushTimeout = 3 * time.Second
+
+// the type of client, identified by stages.
+const (
+	RtmpClientUnknown = "unknown"
+	RtmpClientPlay = "play"
+	RtmpClientFmlePublish = "fmle-publish"
+	RtmpClientFlashPublish = "flash-publish"
+)
 
 type Conn struct {
 	SrsId int
 	Server *Server
 	IoRw *net.TCPConn
+	Ip string // the ip of client, without port.
 	Logger core.Logger
 	Rand *rand.Rand // the random to generate the handshake bytes.
 	InChannel chan *RtmpMessage // the incoming messages channel
@@ -51,6 +69,26 @@ type Conn struct {
 	Stage Stage // the stage of connection.
 	Request RtmpRequest // the request of client
 	StreamId int // current using stream id.
+	ChunkSize int // the out chunk size set by SetChunkSize, queued but maybe not sent yet.
+	sending bool // whether the send message goroutine started.
+	quit chan int // closed by Close to quit the serve cycle.
+	quitOnce sync.Once
+	kicked int32 // whether kicked by Kick, the stage notify the client before close.
+	routines sync.WaitGroup // the pump and send message goroutines.
+	// the timeout to receive messages, set by stages, zero deadline for no timeout.
+	deadline time.Time
+	timeoutReason string
+	timer *time.Timer
+	timerAt time.Time // the time the timer will fire, zero if not armed.
+	sendTimeout int64 // the timeout in ns to send a message, 0 for no timeout.
+	Created time.Time // the time the client connected.
+	Kbps *Kbps // the bytes of the connection.
+	// the client info for other goroutines, for example, the http api.
+	infoLocker sync.RWMutex
+	clientType string
+	clientRequest RtmpRequest
+	// the handlers to call when connection quit, in the serve goroutine.
+	closeHandlers []func()
 }
 
 func (conn *Conn) Serve() {
@@ -66,10 +104,29 @@ func (conn *Conn) Serve() {
 		// the out channel is write by this goroutine only
 		close(conn.OutChannel)
 
-		// quit.
+		// wait for the queued messages to send, for example, the connect reject.
+		if conn.sending {
+			select {
+			case <- conn.SendQuitChannel:
+			case <- time.After(RtmpFlushTimeout):
+				conn.Logger.Warn("flush messages timeout")
+			}
+		}
+
+		if conn.timer != nil {
+			conn.timer.Stop()
+		}
+
+		// quit, the pump message goroutine quit when socket closed.
 		conn.IoRw.Close()
+		conn.routines.Wait()
+
+		for _,h := range conn.closeHandlers {
+			h()
+		}
 		conn.Logger.Info("conn quit")
 	}()
+	conn.Logger.SetField("ip", conn.Ip)
 	conn.Logger.Trace("serve client ip=%v", conn.IoRw.RemoteAddr().String())
 
 	if err := conn.IoRw.SetNoDelay(false); err != nil {
@@ -78,23 +135,53 @@ func (conn *Conn) Serve() {
 	}
 	conn.Logger.Info("tcp SetNoDelay ok")
 
+	// the slow client must complete the handshake in time.
+	if timeout := conn.Server.Factory.HandshakeTimeout(); timeout > 0 {
+		conn.IoRw.SetDeadline(time.Now().Add(timeout))
+	}
 	hs := SimpleHandshake{}
 	if err := hs.WithClient(conn); err != nil {
+		ServerStat.onHandshakeFailed(err)
+		if ne, ok := err.(net.Error); ok && ne.Timeout() {
+			conn.Logger.Warn("handshake timeout, close connection")
+			return
+		}
 		conn.Logger.Error("handshake failed, err is %v", err)
 		return
 	}
+	conn.IoRw.SetDeadline(time.Time{})
 	conn.Logger.Trace("simple handshake with client ok")
 
 	// set stage to connect app.
 	conn.Stage = conn.Server.Factory.NewConnectStage(conn)
 
 	// pump and send message goroutine
-	go conn.pumpMessage()
-	go conn.sendMessage()
+	conn.sending = true
+	conn.routines.Add(2)
+	go func(){
+		defer conn.routines.Done()
+		conn.pumpMessage()
+	}()
+	go func(){
+		defer conn.routines.Done()
+		conn.sendMessage()
+	}()
 
 	// rtmp msg loop
 	for {
 		err := conn.recvMessage()
+		if err == RtmpConnClosed {
+			conn.Logger.Trace("connection closed by server.")
+			break
+		}
+		if err == RtmpConnKicked {
+			conn.Logger.Trace("connection kicked by server.")
+			break
+		}
+		if err == RtmpConnTimeout {
+			conn.Logger.Warn("%v timeout, close connection.", conn.timeoutReason)
+			break
+		}
 		if err == RtmpControlRepublish {
 			conn.Stage = conn.Server.Factory.NewIdenfityStage(conn)
 			conn.Logger.Trace("control message(unpublish) accept, retry stream service.")
@@ -107,16 +194,169 @@ func (conn *Conn) Serve() {
 	conn.Logger.Trace("serve conn ok")
 }
 
+/**
+* close the connection, the serve cycle will cleanup the stage,
+* flush the queued messages then quit.
+* @remark it's safe to close multiple times and in any goroutine.
+*/
+func (conn *Conn) Close() {
+	conn.quitOnce.Do(func(){
+		close(conn.quit)
+	})
+}
+
+/**
+* update the client info by the stage which identified the client,
+* the info is a copy of the request, for other goroutines to read.
+* @remark must be called in the serve goroutine, which owns the request.
+*/
+func (conn *Conn) SetClientInfo(clientType string) {
+	conn.infoLocker.Lock()
+	defer conn.infoLocker.Unlock()
+
+	conn.clientType = clientType
+	conn.clientRequest = conn.Request
+}
+
+// get the client type and request, safe in any goroutine.
+func (conn *Conn) ClientInfo() (clientType string, req RtmpRequest) {
+	conn.infoLocker.RLock()
+	defer conn.infoLocker.RUnlock()
+
+	return conn.clientType, conn.clientRequest
+}
+
+/**
+* add the handler to call when connection quit, after the socket closed,
+* for example, to notify the backend the client is closed.
+* @remark must be called in the serve goroutine.
+*/
+func (conn *Conn) OnClose(h func()) {
+	conn.closeHandlers = append(conn.closeHandlers, h)
+}
+
+/**
+* kick the client off, the stage notify the client then close the connection,
+* for example, the player got the NetStream.Play.Stop.
+* @remark it's safe to kick in any goroutine.
+*/
+func (conn *Conn) Kick() {
+	atomic.StoreInt32(&conn.kicked, 1)
+	conn.Close()
+}
+
+// whether the connection is closed by Close.
+func (conn *Conn) isClosed() bool {
+	select {
+	case <- conn.quit:
+		return true
+	default:
+		return false
+	}
+}
+
+/**
+* set the timeout to receive messages, the serve cycle quit when timeout,
+* for example, the publisher must send media packet in time.
+* @param timeout the timeout from now, 0 for no timeout.
+* @param reason the reason to log when timeout.
+* @remark only used in the serve goroutine, for example, by stages.
+*/
+func (conn *Conn) SetTimeout(timeout time.Duration, reason string) {
+	conn.timeoutReason = reason
+	if timeout <= 0 {
+		conn.deadline = time.Time{}
+		return
+	}
+	conn.deadline = time.Now().Add(timeout)
+
+	// the timer will re-arm when fired before the deadline,
+	// so only reset it when the deadline is earlier.
+	if conn.timer == nil {
+		conn.timer = time.NewTimer(timeout)
+		conn.timerAt = conn.deadline
+	} else if conn.timerAt.IsZero() || conn.deadline.Before(conn.timerAt) {
+		conn.timer.Stop()
+		conn.timer.Reset(timeout)
+		conn.timerAt = conn.deadline
+	}
+}
+
+/**
+* get the deadline and reason to receive messages, zero deadline for no timeout.
+* @remark only used in the serve goroutine, for example, by stages.
+*/
+func (conn *Conn) Timeout() (deadline time.Time, reason string) {
+	return conn.deadline, conn.timeoutReason
+}
+
+// when the timer fired, whether the deadline exceed, re-arm the timer if not.
+func (conn *Conn) onTimer() bool {
+	conn.timerAt = time.Time{}
+	if conn.deadline.IsZero() {
+		return false
+	}
+
+	if d := conn.deadline.Sub(time.Now()); d > 0 {
+		conn.timer.Reset(d)
+		conn.timerAt = conn.deadline
+		return false
+	}
+	return true
+}
+
+/**
+* set the timeout to send each message, the connection closed when timeout,
+* for example, the player stall to receive messages.
+* @param timeout the timeout of each message, 0 for no timeout.
+* @remark it's safe to set in any goroutine.
+*/
+func (conn *Conn) SetSendTimeout(timeout time.Duration) {
+	atomic.StoreInt64(&conn.sendTimeout, int64(timeout))
+}
+
+// get the timeout to send each message, 0 for no timeout.
+func (conn *Conn) SendTimeout() time.Duration {
+	return time.Duration(atomic.LoadInt64(&conn.sendTimeout))
+}
+
 func (conn *Conn) recvMessage() (err error) {
 	for {
+		var timeout <-chan time.Time
+		if conn.timer != nil {
+			timeout = conn.timer.C
+		}
+
 		select {
+			// when timeout to receive messages.
+		case <- timeout:
+			if conn.onTimer() {
+				conn.Stage.Cleanup()
+				return RtmpConnTimeout
+			}
+			continue
 			// the send message goroutine will close this channel when error
 		case <- conn.SendQuitChannel:
+			conn.Stage.Cleanup()
 			return
+			// when closed by server, cleanup the stage and quit.
+		case <- conn.quit:
+			if atomic.LoadInt32(&conn.kicked) == 0 {
+				conn.Stage.Cleanup()
+				return RtmpConnClosed
+			}
+			if stage, ok := conn.Stage.(KickedStage); ok {
+				if err := stage.OnKicked(); err != nil {
+					conn.Logger.Warn("notify client kicked failed, err is %v", err)
+				}
+			}
+			conn.Stage.Cleanup()
+			return RtmpConnKicked
 			// when incoming message, process it.
 			// the pump message goroutine will close this channel when error
 		case msg, ok := <- conn.InChannel:
 			if !ok {
+				conn.Stage.Cleanup()
 				return
 			}
 			conn.Logger.Info("consume received msg %v", msg)
@@ -154,9 +394,16 @@ func (conn *Conn) sendMessage() (err error) {
 				return
 			}
 			conn.Logger.Info("send msg %v", msg)
+			if timeout := conn.SendTimeout(); timeout > 0 {
+				conn.IoRw.SetWriteDeadline(time.Now().Add(timeout))
+			}
 			if err = conn.Protocol.SendMessage(msg); err != nil {
+				if ne, ok := err.(net.Error); ok && ne.Timeout() {
+					conn.Logger.Warn("send message stall, close connection.")
+				}
 				return
 			}
+			ServerStat.onSendMessage()
 			continue
 		}
 	}
@@ -183,7 +430,7 @@ func (conn *Conn) pumpMessage() {
 		var msg *RtmpMessage
 		var err error
 		if msg,err = conn.Protocol.PumpMessage(); err != nil {
-			if err != io.EOF {
+			if err != io.EOF && !conn.isClosed() {
 				conn.Logger.Error("pump message failed, err is %v", err)
 			}
 			return
@@ -193,17 +440,20 @@ func (conn *Conn) pumpMessage() {
 		if msg == nil {
 			continue
 		}
+		ServerStat.onRecvMessage()
 
 		select {
 		case conn.InChannel <- msg:
 			break
 		default:
+			ServerStat.onDropPumpMessage()
 			conn.Logger.Warn("drop incoming msg for channel full")
 			break
 		}
 	}
 }
 
+// queue the source message to send, return RtmpOutChannelFull when dropped for channel full.
 func (conn *Conn) EnqueueSourceMessage(msg *RtmpMessage, streamId int) (err error) {
 	defer func(){
 		if err := recover(); err != nil {
@@ -217,19 +467,21 @@ func (conn *Conn) EnqueueSourceMessage(msg *RtmpMessage, streamId int) (err erro
 	case conn.OutChannel <- msg:
 		break
 	default:
+		ServerStat.onDropSourceMessage()
 		conn.Logger.Warn("drop source message for channel full")
-		break
+		return RtmpOutChannelFull
 	}
 	return
 }
 
+// queue the message to send, return error when dropped for channel full.
 func (conn *Conn) EnqueueOutgoingMessage(msg *RtmpMessage) (err error) {
 	select {
 	case conn.OutChannel <- msg:
 		break
 	default:
 		conn.Logger.Warn("drop outgoing message for channel full")
-		break
+		return RtmpOutChannelFull
 	}
 	return
 }
@@ -313,6 +565,21 @@ func (conn *Conn) ResponseConnectApp(objectEncoding int, serverIp string) (err e
 	return conn.EnqueueOutgoingMessage(msg)
 }
 
+func (conn *Conn) ResponseConnectReject(description string) (err error) {
+	pkt := NewRtmpOnStatusCallPacket().(*RtmpOnStatusCallPacket)
+	pkt.CommandName = Amf0String(RTMP_AMF0_COMMAND_ERROR)
+	pkt.TransactionId = Amf0Number(1.0)
+	pkt.Data.Set(StatusLevel, Amf0String(StatusLevelError))
+	pkt.Data.Set(StatusCode, Amf0String(StatusCodeConnectRejected))
+	pkt.Data.Set(StatusDescription, Amf0String(description))
+
+	var msg *RtmpMessage
+	if msg,err = conn.Protocol.EncodeMessage(pkt, 0); err != nil {
+		return
+	}
+	return conn.EnqueueOutgoingMessage(msg)
+}
+
 func (conn *Conn) ResponseReleaseStream(transactionId float64) (err error) {
 	pkt := NewRtmpCallPacket().(*RtmpCallPacket)
 	pkt.CommandName = Amf0String(RTMP_AMF0_COMMAND_RESULT)
@@ -403,6 +670,81 @@ func (conn *Conn) OnStatusStreamStart(streamId int) (err error) {
 	return conn.EnqueueOutgoingMessage(msg)
 }
 
+func (conn *Conn) OnStatusPlayStop(streamId int) (err error) {
+	pkt := NewRtmpOnStatusCallPacket().(*RtmpOnStatusCallPacket)
+	pkt.Data.Set(StatusLevel, Amf0String(StatusLevelStatus))
+	pkt.Data.Set(StatusCode, Amf0String(StatusCodeStreamStop))
+	pkt.Data.Set(StatusDescription, Amf0String("Stopped playing stream."))
+	pkt.Data.Set(StatusDetails, Amf0String("stream"))
+	pkt.Data.Set(StatusClientId, Amf0String(RTMP_SIG_CLIENT_ID))
+
+	var msg *RtmpMessage
+	if msg,err = conn.Protocol.EncodeMessage(pkt, streamId); err != nil {
+		return
+	}
+	return conn.EnqueueOutgoingMessage(msg)
+}
+
+func (conn *Conn) OnStatusUnpublishNotify(streamId int) (err error) {
+	pkt := NewRtmpOnStatusCallPacket().(*RtmpOnStatusCallPacket)
+	pkt.Data.Set(StatusLevel, Amf0String(StatusLevelStatus))
+	pkt.Data.Set(StatusCode, Amf0String(StatusCodeUnpublishNotify))
+	pkt.Data.Set(StatusDescription, Amf0String("The stream is unpublished."))
+	pkt.Data.Set(StatusDetails, Amf0String("stream"))
+	pkt.Data.Set(StatusClientId, Amf0String(RTMP_SIG_CLIENT_ID))
+
+	var msg *RtmpMessage
+	if msg,err = conn.Protocol.EncodeMessage(pkt, streamId); err != nil {
+		return
+	}
+	return conn.EnqueueOutgoingMessage(msg)
+}
+
+func (conn *Conn) OnStatusUnpublish(streamId int) (err error) {
+	pkt := NewRtmpOnStatusCallPacket().(*RtmpOnStatusCallPacket)
+	pkt.Data.Set(StatusLevel, Amf0String(StatusLevelStatus))
+	pkt.Data.Set(StatusCode, Amf0String(StatusCodeUnpublishSuccess))
+	pkt.Data.Set(StatusDescription, Amf0String("Stream is stopped by server."))
+	pkt.Data.Set(StatusClientId, Amf0String(RTMP_SIG_CLIENT_ID))
+
+	var msg *RtmpMessage
+	if msg,err = conn.Protocol.EncodeMessage(pkt, streamId); err != nil {
+		return
+	}
+	return conn.EnqueueOutgoingMessage(msg)
+}
+
+// reject the publish, for example, the token is invalid.
+func (conn *Conn) OnStatusPublishDenied(streamId int, description string) (err error) {
+	pkt := NewRtmpOnStatusCallPacket().(*RtmpOnStatusCallPacket)
+	pkt.Data.Set(StatusLevel, Amf0String(StatusLevelError))
+	pkt.Data.Set(StatusCode, Amf0String(StatusCodePublishDenied))
+	pkt.Data.Set(StatusDescription, Amf0String(description))
+	pkt.Data.Set(StatusClientId, Amf0String(RTMP_SIG_CLIENT_ID))
+
+	var msg *RtmpMessage
+	if msg,err = conn.Protocol.EncodeMessage(pkt, streamId); err != nil {
+		return
+	}
+	return conn.EnqueueOutgoingMessage(msg)
+}
+
+// reject the play, for example, the token is invalid.
+func (conn *Conn) OnStatusPlayFailed(streamId int, description string) (err error) {
+	pkt := NewRtmpOnStatusCallPacket().(*RtmpOnStatusCallPacket)
+	pkt.Data.Set(StatusLevel, Amf0String(StatusLevelError))
+	pkt.Data.Set(StatusCode, Amf0String(StatusCodePlayFailed))
+	pkt.Data.Set(StatusDescription, Amf0String(description))
+	pkt.Data.Set(StatusDetails, Amf0String("stream"))
+	pkt.Data.Set(StatusClientId, Amf0String(RTMP_SIG_CLIENT_ID))
+
+	var msg *RtmpMessage
+	if msg,err = conn.Protocol.EncodeMessage(pkt, streamId); err != nil {
+		return
+	}
+	return conn.EnqueueOutgoingMessage(msg)
+}
+
 func (conn *Conn) OnStatusData(streamId int) (err error) {
 	pkt := NewRtmpOnStatusDataPacket().(*RtmpOnStatusDataPacket)
 	pkt.Data.Set(StatusCode, Amf0String(StatusCodeDataStart))
@@ -414,6 +756,24 @@ func (conn *Conn) OnStatusData(streamId int) (err error) {
 	return conn.EnqueueOutgoingMessage(msg)
 }
 
+func (conn *Conn) OnStatusPause(streamId int, isPause bool) (err error) {
+	pkt := NewRtmpOnStatusCallPacket().(*RtmpOnStatusCallPacket)
+	pkt.Data.Set(StatusLevel, Amf0String(StatusLevelStatus))
+	if isPause {
+		pkt.Data.Set(StatusCode, Amf0String(StatusCodeStreamPause))
+		pkt.Data.Set(StatusDescription, Amf0String("Paused stream."))
+	} else {
+		pkt.Data.Set(StatusCode, Amf0String(StatusCodeStreamUnpause))
+		pkt.Data.Set(StatusDescription, Amf0String("Unpaused stream."))
+	}
+
+	var msg *RtmpMessage
+	if msg,err = conn.Protocol.EncodeMessage(pkt, streamId); err != nil {
+		return
+	}
+	return conn.EnqueueOutgoingMessage(msg)
+}
+
 func (conn *Conn) SetChunkSize(chunkSize int) (err error) {
 	pkt := NewRtmpSetChunkSizePacket().(*RtmpSetChunkSizePacket)
 	pkt.ChunkSize = int32(chunkSize)
@@ -422,7 +782,11 @@ func (conn *Conn) SetChunkSize(chunkSize int) (err error) {
 	if msg,err = conn.Protocol.EncodeMessage(pkt, 0); err != nil {
 		return
 	}
-	return conn.EnqueueOutgoingMessage(msg)
+	if err = conn.EnqueueOutgoingMessage(msg); err != nil {
+		return
+	}
+	conn.ChunkSize = chunkSize
+	return
 }
 
 func (conn *Conn) SampleAccess(streamId int, vsa, asa bool) (err error) {
@@ -449,12 +813,33 @@ func (conn *Conn) ResponseStreamBegin(streamId int) (err error) {
 	return conn.EnqueueOutgoingMessage(msg)
 }
 
+func (conn *Conn) ResponseStreamEOF(streamId int) (err error) {
+	pkt := NewRtmpUserControlPacket().(*RtmpUserControlPacket)
+	pkt.EventType = SrcPCUCStreamEOF
+	pkt.EventData = int32(streamId)
+
+	var msg *RtmpMessage
+	if msg,err = conn.Protocol.EncodeMessage(pkt, streamId); err != nil {
+		return
+	}
+	return conn.EnqueueOutgoingMessage(msg)
+}
+
 func NewConn(svr *Server, conn *net.TCPConn) *Conn {
 	v := &Conn{
 		Server: svr,
 		IoRw: conn,
 		Rand: rand.New(rand.NewSource(time.Now().UnixNano())),
 		StreamId: SRS_DEFAULT_SID - 1, // we always increase it when create stream.
+		ChunkSize: SRS_CONSTS_RTMP_PROTOCOL_CHUNK_SIZE,
+		Created: time.Now(),
+		Kbps: NewKbps(),
+		clientType: RtmpClientUnknown,
+	}
+
+	v.Ip = conn.RemoteAddr().String()
+	if ip, _, err := net.SplitHostPort(v.Ip); err == nil {
+		v.Ip = ip
 	}
 
 	// the srs id
@@ -465,9 +850,10 @@ func NewConn(svr *Server, conn *net.TCPConn) *Conn {
 	v.InChannel = make(chan *RtmpMessage, 1024)
 	v.OutChannel = make(chan *RtmpMessage, 1024)
 	v.SendQuitChannel = make(chan int)
+	v.quit = make(chan int)
 
 	// initialize the protocol stack.
-	v.Protocol = NewProtocol(conn, v.Logger)
+	v.Protocol = NewProtocol(&kbpsReadWriter{rw: conn, kbps: v.Kbps}, v.Logger)
 
 	// nil stage for handshake.
 	v.Stage = nil
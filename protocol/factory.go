@@ -23,10 +23,19 @@ CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
 
 package protocol
 
-import "github.com/cittu/go-srs/core"
+import (
+    "github.com/cittu/go-srs/core"
+    "time"
+)
 
 type Factory interface {
     core.Factory
     NewConnectStage(conn *Conn) Stage
     NewIdenfityStage(conn *Conn) Stage
+    // the timeout to complete the handshake, 0 for no timeout.
+    HandshakeTimeout() time.Duration
+    // check the connection from ip before handshake, return error to reject it,
+    // the OnRelease is called when the accepted connection quit.
+    OnAccept(ip string) error
+    OnRelease(ip string)
 }
@@ -30,6 +30,8 @@ import (
     "bytes"
     "time"
     "net"
+    "math/rand"
+    "github.com/cittu/go-srs/core"
 )
 
 var RtmpPlainRequired = errors.New("only support rtmp plain text")
@@ -97,3 +99,48 @@ func (hs *SimpleHandshake) WithClient(conn *Conn) error {
 
     return nil
 }
+
+/**
+* the plain handshake with server, as client,
+* send c0c1, read s0s1s2, then send s1 as c2.
+*/
+func (hs *SimpleHandshake) WithServer(iorw io.ReadWriter, r *rand.Rand, logger core.Logger) error {
+    // use bytes buffer to write content.
+    c0c1 := bytes.NewBuffer(make([]byte, 0, 1537))
+
+    // plain text required.
+    binary.Write(c0c1, binary.BigEndian, byte(0x03))
+    // c1 time and zero
+    binary.Write(c0c1, binary.BigEndian, int32(time.Now().Unix()))
+    binary.Write(c0c1, binary.BigEndian, int32(0))
+    // c1 1528 random bytes
+    c0c1Random := make([]byte, 1528)
+    RandomGenerate(r, c0c1Random)
+    c0c1.Write(c0c1Random)
+
+    if written,err := iorw.Write(c0c1.Bytes()); err != nil {
+        logger.Error("send c0c1 failed, written=%d, err is %v", written, err)
+        return err
+    }
+    logger.Info("send c0c1 ok")
+
+    s0s1s2 := make([]byte, 3073)
+    if _,err := io.ReadFull(iorw, s0s1s2); err != nil {
+        logger.Error("read s0s1s2 failed, err is %v", err)
+        return err
+    }
+    logger.Info("read s0s1s2 ok")
+
+    if s0s1s2[0] != 0x03 {
+        logger.Error("rtmp plain required 0x03, actual is %#x", s0s1s2[0])
+        return RtmpPlainRequired
+    }
+
+    if written,err := iorw.Write(s0s1s2[1:1537]); err != nil {
+        logger.Error("send c2 failed, written=%d, err is %v", written, err)
+        return err
+    }
+    logger.Info("send c2 ok")
+
+    return nil
+}
@@ -0,0 +1,117 @@
+/*
+The MIT License (MIT)
+
+Copyright (c) 2013-2014 winlin
+
+Permission is hereby granted, free of charge, to any person obtaining a copy of
+this software and associated documentation files (the "Software"), to deal in
+the Software without restriction, including without limitation the rights to
+use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+the Software, and to permit persons to whom the Software is furnished to do so,
+subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+*/
+
+package protocol
+
+import (
+    "io"
+    "sync"
+    "sync/atomic"
+    "time"
+)
+
+/**
+* the bytes and kbps statistic,
+* the kbps is the average between the last two samples.
+*/
+type Kbps struct {
+    recvBytes int64
+    sendBytes int64
+    locker sync.Mutex
+    // the last sample.
+    sampleTime time.Time
+    sampleRecv int64
+    sampleSend int64
+    // the kbps between the last two samples.
+    recvKbps int
+    sendKbps int
+}
+
+func NewKbps() *Kbps {
+    return &Kbps{sampleTime: time.Now()}
+}
+
+func (v *Kbps) AddRecvBytes(n int) {
+    atomic.AddInt64(&v.recvBytes, int64(n))
+}
+
+func (v *Kbps) AddSendBytes(n int) {
+    atomic.AddInt64(&v.sendBytes, int64(n))
+}
+
+func (v *Kbps) RecvBytes() int64 {
+    return atomic.LoadInt64(&v.recvBytes)
+}
+
+func (v *Kbps) SendBytes() int64 {
+    return atomic.LoadInt64(&v.sendBytes)
+}
+
+// sample the bytes, to calc the kbps since last sample.
+func (v *Kbps) Sample() {
+    v.locker.Lock()
+    defer v.locker.Unlock()
+
+    now := time.Now()
+    recv, send := v.RecvBytes(), v.SendBytes()
+    if ms := int64(now.Sub(v.sampleTime) / time.Millisecond); ms > 0 {
+        v.recvKbps = int((recv - v.sampleRecv) * 8 / ms)
+        v.sendKbps = int((send - v.sampleSend) * 8 / ms)
+    }
+    v.sampleTime, v.sampleRecv, v.sampleSend = now, recv, send
+}
+
+func (v *Kbps) RecvKbps() int {
+    v.locker.Lock()
+    defer v.locker.Unlock()
+    return v.recvKbps
+}
+
+func (v *Kbps) SendKbps() int {
+    v.locker.Lock()
+    defer v.locker.Unlock()
+    return v.sendKbps
+}
+
+// the bytes of all connections, for the summaries of server.
+var ServerKbps = NewKbps()
+
+// the io which count the bytes to kbps of connection and server.
+type kbpsReadWriter struct {
+    rw io.ReadWriter
+    kbps *Kbps
+}
+
+func (v *kbpsReadWriter) Read(p []byte) (n int, err error) {
+    n,err = v.rw.Read(p)
+    v.kbps.AddRecvBytes(n)
+    ServerKbps.AddRecvBytes(n)
+    return
+}
+
+func (v *kbpsReadWriter) Write(p []byte) (n int, err error) {
+    n,err = v.rw.Write(p)
+    v.kbps.AddSendBytes(n)
+    ServerKbps.AddSendBytes(n)
+    return
+}
@@ -60,11 +60,15 @@ const (
     StatusCodeConnectRejected = "NetConnection.Connect.Rejected"
     StatusCodeStreamReset = "NetStream.Play.Reset"
     StatusCodeStreamStart = "NetStream.Play.Start"
+    StatusCodeStreamStop = "NetStream.Play.Stop"
     StatusCodeStreamPause = "NetStream.Pause.Notify"
     StatusCodeStreamUnpause = "NetStream.Unpause.Notify"
     StatusCodePublishStart = "NetStream.Publish.Start"
     StatusCodeDataStart = "NetStream.Data.Start"
     StatusCodeUnpublishSuccess = "NetStream.Unpublish.Success"
+    StatusCodeUnpublishNotify = "NetStream.Play.UnpublishNotify"
+    StatusCodePublishDenied = "NetStream.Publish.Denied"
+    StatusCodePlayFailed = "NetStream.Play.Failed"
 
     // FMLE
     RTMP_AMF0_COMMAND_ON_FC_PUBLISH = "onFCPublish"
@@ -204,6 +208,21 @@ func DiscoveryPacket(msg *RtmpMessage, logger core.Logger) (b []byte, pkt RtmpPa
         case RTMP_AMF0_COMMAND_PUBLISH:
             logger.Info("decode the AMF0/AMF3 command(publish message).")
             pkt = NewRtmpPublishPacket()
+        case RTMP_AMF0_COMMAND_PAUSE:
+            logger.Info("decode the AMF0/AMF3 command(pause message).")
+            pkt = NewRtmpPausePacket()
+        case RTMP_AMF0_COMMAND_RECEIVE_AUDIO:
+            logger.Info("decode the AMF0/AMF3 command(receiveAudio message).")
+            pkt = NewRtmpReceiveAudioPacket()
+        case RTMP_AMF0_COMMAND_RECEIVE_VIDEO:
+            logger.Info("decode the AMF0/AMF3 command(receiveVideo message).")
+            pkt = NewRtmpReceiveVideoPacket()
+        case RTMP_AMF0_COMMAND_CLOSE_STREAM:
+            logger.Info("decode the AMF0/AMF3 command(closeStream message).")
+            pkt = NewRtmpCloseStreamPacket()
+        case RTMP_AMF0_COMMAND_DELETE_STREAM:
+            logger.Info("decode the AMF0/AMF3 command(deleteStream message).")
+            pkt = NewRtmpDeleteStreamPacket()
         default:
             if header.IsAmf0Command() || header.IsAmf3Command() {
                 logger.Info("decode the AMF0/AMF3 call message.")
@@ -789,6 +808,114 @@ func (pkt *RtmpCreateStreamResPacket) PerferCid() int {
     return RTMP_CID_OverConnection
 }
 
+/**
+* client close stream packet.
+*/
+type RtmpCloseStreamPacket struct {
+    rtmpCommonCallPacket
+    /**
+    * Command information object does not exist. Set to null type.
+    * @remark, never be NULL, an AMF0 null instance.
+    */
+    CommandObject Amf0Null
+}
+
+func NewRtmpCloseStreamPacket() RtmpPacket {
+    v := &RtmpCloseStreamPacket{}
+    v.CommandName = Amf0String(RTMP_AMF0_COMMAND_CLOSE_STREAM)
+    v.TransactionId = Amf0Number(0.0)
+    return v
+}
+
+func (pkt *RtmpCloseStreamPacket) Decode(buffer *bytes.Buffer, logger core.Logger) (err error) {
+    if err = pkt.rtmpCommonCallPacket.Decode(buffer, logger); err != nil {
+        return
+    }
+    if err = DecodeAmf0Null(buffer); err != nil {
+        return
+    }
+    return
+}
+
+func (pkt *RtmpCloseStreamPacket) Encode(buffer *bytes.Buffer, logger core.Logger) (err error) {
+    if err = pkt.rtmpCommonCallPacket.Encode(buffer, logger); err != nil {
+        return
+    }
+    if err = EncodeAmf0Null(buffer); err != nil {
+        return
+    }
+    return
+}
+
+func (pkt *RtmpCloseStreamPacket) MessageType() byte {
+    return RTMP_MSG_AMF0CommandMessage
+}
+
+func (pkt *RtmpCloseStreamPacket) PerferCid() int {
+    return RTMP_CID_OverStream
+}
+
+/**
+* 7.2.2.3. deleteStream
+* NetStream sends the deleteStream command when the NetStream object
+* is getting destroyed.
+*/
+type RtmpDeleteStreamPacket struct {
+    rtmpCommonCallPacket
+    /**
+    * Command information object does not exist. Set to null type.
+    * @remark, never be NULL, an AMF0 null instance.
+    */
+    CommandObject Amf0Null
+    /**
+    * The ID of the stream that is destroyed on the server.
+    */
+    StreamId Amf0Number
+}
+
+func NewRtmpDeleteStreamPacket() RtmpPacket {
+    v := &RtmpDeleteStreamPacket{}
+    v.CommandName = Amf0String(RTMP_AMF0_COMMAND_DELETE_STREAM)
+    v.TransactionId = Amf0Number(0.0)
+    return v
+}
+
+func (pkt *RtmpDeleteStreamPacket) Decode(buffer *bytes.Buffer, logger core.Logger) (err error) {
+    if err = pkt.rtmpCommonCallPacket.Decode(buffer, logger); err != nil {
+        return
+    }
+    if err = DecodeAmf0Null(buffer); err != nil {
+        return
+    }
+    if buffer.Len() > 0 {
+        if pkt.StreamId,err = DecodeAmf0Number(buffer); err != nil {
+            return
+        }
+    }
+    return
+}
+
+func (pkt *RtmpDeleteStreamPacket) Encode(buffer *bytes.Buffer, logger core.Logger) (err error) {
+    if err = pkt.rtmpCommonCallPacket.Encode(buffer, logger); err != nil {
+        return
+    }
+    if err = EncodeAmf0Null(buffer); err != nil {
+        return
+    }
+    if err = EncodeAmf0Number(buffer, pkt.StreamId); err != nil {
+        return
+    }
+    return
+}
+
+func (pkt *RtmpDeleteStreamPacket) MessageType() byte {
+    return RTMP_MSG_AMF0CommandMessage
+}
+
+func (pkt *RtmpDeleteStreamPacket) PerferCid() int {
+    return RTMP_CID_OverStream
+}
+
 /**
 * 4.2.1. play
 * The client sends this command to the server to play a stream.
@@ -914,6 +1041,156 @@ func (pkt *RtmpPlayPacket) PerferCid() int {
     return RTMP_CID_OverStream
 }
 
+/**
+* 4.2.8. pause
+* The client sends the pause command to tell the server to pause or
+* start playing.
+*/
+type RtmpPausePacket struct {
+    rtmpCommonCallPacket
+    /**
+    * Command information object does not exist. Set to null type.
+    * @remark, never be NULL, an AMF0 null instance.
+    */
+    CommandObject Amf0Null
+    /**
+    * true or false, to indicate pausing or resuming play
+    */
+    IsPause Amf0Boolean
+    /**
+    * Number of milliseconds at which the the stream is paused or play resumed.
+    * This is the current stream time at the Client when stream was paused. When the
+    * playback is resumed, the server will only send messages with timestamps
+    * greater than this value.
+    */
+    TimeMs Amf0Number
+}
+
+func NewRtmpPausePacket() RtmpPacket {
+    v := &RtmpPausePacket{}
+    v.CommandName = Amf0String(RTMP_AMF0_COMMAND_PAUSE)
+    v.TransactionId = Amf0Number(0.0)
+    v.IsPause = Amf0Boolean(true)
+    return v
+}
+
+func (pkt *RtmpPausePacket) Decode(buffer *bytes.Buffer, logger core.Logger) (err error) {
+    if err = pkt.rtmpCommonCallPacket.Decode(buffer, logger); err != nil {
+        return
+    }
+    if err = DecodeAmf0Null(buffer); err != nil {
+        return
+    }
+    if pkt.IsPause,err = DecodeAmf0Boolean(buffer); err != nil {
+        return
+    }
+    if pkt.TimeMs,err = DecodeAmf0Number(buffer); err != nil {
+        return
+    }
+    return
+}
+
+func (pkt *RtmpPausePacket) Encode(buffer *bytes.Buffer, logger core.Logger) (err error) {
+    if err = pkt.rtmpCommonCallPacket.Encode(buffer, logger); err != nil {
+        return
+    }
+    if err = EncodeAmf0Null(buffer); err != nil {
+        return
+    }
+    if err = EncodeAmf0Boolean(buffer, pkt.IsPause); err != nil {
+        return
+    }
+    if err = EncodeAmf0Number(buffer, pkt.TimeMs); err != nil {
+        return
+    }
+    return
+}
+
+func (pkt *RtmpPausePacket) MessageType() byte {
+    return RTMP_MSG_AMF0CommandMessage
+}
+
+func (pkt *RtmpPausePacket) PerferCid() int {
+    return RTMP_CID_OverStream
+}
+
+/**
+* 4.2.3. receiveAudio
+* NetStream sends the receiveAudio message to inform the server whether
+* to send or not to send the audio to the client.
+*/
+type RtmpReceiveAudioPacket struct {
+    rtmpCommonCallPacket
+    /**
+    * Command information object does not exist. Set to null type.
+    * @remark, never be NULL, an AMF0 null instance.
+    */
+    CommandObject Amf0Null
+    /**
+    * true or false to indicate whether to receive audio or not.
+    */
+    BoolFlag Amf0Boolean
+}
+
+func NewRtmpReceiveAudioPacket() RtmpPacket {
+    v := &RtmpReceiveAudioPacket{}
+    v.CommandName = Amf0String(RTMP_AMF0_COMMAND_RECEIVE_AUDIO)
+    v.TransactionId = Amf0Number(0.0)
+    v.BoolFlag = Amf0Boolean(true)
+    return v
+}
+
+func (pkt *RtmpReceiveAudioPacket) Decode(buffer *bytes.Buffer, logger core.Logger) (err error) {
+    if err = pkt.rtmpCommonCallPacket.Decode(buffer, logger); err != nil {
+        return
+    }
+    if err = DecodeAmf0Null(buffer); err != nil {
+        return
+    }
+    if pkt.BoolFlag,err = DecodeAmf0Boolean(buffer); err != nil {
+        return
+    }
+    return
+}
+
+func (pkt *RtmpReceiveAudioPacket) Encode(buffer *bytes.Buffer, logger core.Logger) (err error) {
+    if err = pkt.rtmpCommonCallPacket.Encode(buffer, logger); err != nil {
+        return
+    }
+    if err = EncodeAmf0Null(buffer); err != nil {
+        return
+    }
+    if err = EncodeAmf0Boolean(buffer, pkt.BoolFlag); err != nil {
+        return
+    }
+    return
+}
+
+func (pkt *RtmpReceiveAudioPacket) MessageType() byte {
+    return RTMP_MSG_AMF0CommandMessage
+}
+
+func (pkt *RtmpReceiveAudioPacket) PerferCid() int {
+    return RTMP_CID_OverStream
+}
+
+/**
+* 4.2.4. receiveVideo
+* NetStream sends the receiveVideo message to inform the server whether
+* to send the video to the client or not.
+*/
+type RtmpReceiveVideoPacket struct {
+    RtmpReceiveAudioPacket
+}
+
+func NewRtmpReceiveVideoPacket() RtmpPacket {
+    v := &RtmpReceiveVideoPacket{}
+    v.CommandName = Amf0String(RTMP_AMF0_COMMAND_RECEIVE_VIDEO)
+    v.TransactionId = Amf0Number(0.0)
+    v.BoolFlag = Amf0Boolean(true)
+    return v
+}
+
 /**
 * FMLE start publish: ReleaseStream
 */
@@ -25,13 +25,14 @@ package protocol
 
 import (
 	"github.com/cittu/go-srs/core"
-	"net"
 	"encoding/binary"
 	"io"
 	"fmt"
 	"errors"
 	"bytes"
 	"math"
+	"net/url"
+	"strings"
 )
 
 var RtmpChunkStart = errors.New("new chunk stream cid must be fresh")
@@ -245,8 +246,11 @@ const (
 	RTMP_AMF0_COMMAND_CONNECT = "connect"
 	RTMP_AMF0_COMMAND_CREATE_STREAM = "createStream"
 	RTMP_AMF0_COMMAND_CLOSE_STREAM = "closeStream"
+	RTMP_AMF0_COMMAND_DELETE_STREAM = "deleteStream"
 	RTMP_AMF0_COMMAND_PLAY = "play"
 	RTMP_AMF0_COMMAND_PAUSE = "pause"
+	RTMP_AMF0_COMMAND_RECEIVE_AUDIO = "receiveAudio"
+	RTMP_AMF0_COMMAND_RECEIVE_VIDEO = "receiveVideo"
 	RTMP_AMF0_COMMAND_ON_BW_DONE = "onBWDone"
 	RTMP_AMF0_COMMAND_ON_STATUS = "onStatus"
 	RTMP_AMF0_COMMAND_RESULT = "_result"
@@ -269,7 +273,7 @@ type AckWindowSize struct {
 }
 
 type Protocol struct {
-	IoRw *net.TCPConn
+	IoRw io.ReadWriter
 	Logger core.Logger
 	ChunkStreams map[int]*ChunkStream
 	InChunkSize int
@@ -280,7 +284,7 @@ type Protocol struct {
 	InAckSize AckWindowSize
 }
 
-func NewProtocol(iorw *net.TCPConn, logger core.Logger) *Protocol {
+func NewProtocol(iorw io.ReadWriter, logger core.Logger) *Protocol {
 	v := &Protocol{
 		IoRw: iorw,
 		Logger: logger,
@@ -1105,6 +1109,18 @@ func NewRtmpMessage() *RtmpMessage {
 	}
 }
 
+/**
+* copy the message header, the payload is shared.
+* used for source to dispatch msg to consumers,
+* which may modify the header, for example, the timestamp and stream id.
+*/
+func (msg *RtmpMessage) Copy() *RtmpMessage {
+	return &RtmpMessage{
+		Header: msg.Header,
+		Payload: msg.Payload,
+	}
+}
+
 func (msg *RtmpMessage) String() string {
 	return fmt.Sprintf("Message(%v,%v,%v)",
 		msg.Header.MessageType, msg.Header.Timestamp, msg.Header.PayloadLength)
@@ -1145,14 +1161,79 @@ type RtmpRequest struct {
 	// @see https://github.com/winlinvip/simple-rtmp-server/issues/45
 	// in ms.
 	Duration float64
+	// the vhost and param of tcUrl, the stream query of each play or publish
+	// is merged to them, for the client may play or publish again.
+	tcUrlVhost string
+	tcUrlParam string
 	// the token in the connect request,
 	// used for edge traverse to origin authentication,
 	// @see https://github.com/winlinvip/simple-rtmp-server/issues/104
 	Args *Amf0Object
 }
 
+/**
+* get the canonical stream url, vhost/app/stream,
+* the vhost is case insensitive and the slashes are trimmed,
+* which is used as the key of source.
+*/
 func (req *RtmpRequest) StreamUrl() string {
-	return fmt.Sprintf("%s/%s/%s", req.Vhost, req.App, req.Stream)
+	vhost := strings.ToLower(strings.TrimSpace(req.Vhost))
+	app := strings.Trim(strings.TrimSpace(req.App), "/")
+	stream := strings.Trim(strings.TrimSpace(req.Stream), "/")
+	return fmt.Sprintf("%s/%s/%s", vhost, app, stream)
+}
+
+/**
+* parse the stream name of play or publish,
+* the query of stream is merged into the param of tcUrl,
+* and the vhost in stream query overrides the vhost of tcUrl.
+* for example, play("livestream?token=abc&vhost=demo")
+*/
+func (req *RtmpRequest) ParseStream(streamName string, logger core.Logger) (err error) {
+	// always parse from the tcUrl, drop the query of previous stream.
+	req.Vhost, req.Param = req.tcUrlVhost, req.tcUrlParam
+
+	var param string
+	req.Stream,param = DiscoveryStreamName(streamName, logger)
+	if param == "" {
+		return
+	}
+
+	var query url.Values
+	if query,err = url.ParseQuery(param); err != nil {
+		logger.Error("parse stream param=%v failed, err is %v", param, err)
+		return
+	}
+
+	var merged url.Values
+	if merged,err = url.ParseQuery(req.Param); err != nil {
+		logger.Error("parse tcUrl param=%v failed, err is %v", req.Param, err)
+		return
+	}
+	for k,v := range query {
+		merged[k] = v
+	}
+	req.Param = merged.Encode()
+
+	if v := query.Get("vhost"); v != "" {
+		logger.Info("vhost override from %v to %v by stream", req.Vhost, v)
+		req.Vhost = v
+	}
+
+	logger.Info("stream=%v, param=%v, vhost=%v", req.Stream, req.Param, req.Vhost)
+	return
+}
+
+/**
+* get the value of param, from tcUrl or stream query,
+* for example, the token=abc of stream livestream?token=abc.
+*/
+func (req *RtmpRequest) GetParam(name string) string {
+	query,err := url.ParseQuery(req.Param)
+	if err != nil {
+		return ""
+	}
+	return query.Get(name)
 }
 
 func (req *RtmpRequest) FormatArgs() string {
@@ -1192,6 +1273,7 @@ func (req *RtmpRequest) Parse(cc, args *Amf0Object, logger core.Logger) (err err
 	logger.Info("get connect app message params success.")
 
 	req.Schema,req.Host,req.Vhost,req.App,req.Port,req.Param,err = DiscoveryTcUrl(req.TcUrl, logger)
+	req.tcUrlVhost, req.tcUrlParam = req.Vhost, req.Param
 	logger.Info("tcUrl=%v parsed", req.TcUrl)
 
 	return
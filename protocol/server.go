@@ -25,13 +25,30 @@ package protocol
 
 import (
 	"net"
+	"sync"
+	"errors"
+	"context"
 	"github.com/cittu/go-srs/core"
 )
 
+var RtmpServerClosed = errors.New("rtmp server closed")
+
 type Server struct {
 	Addr string
 	Factory Factory
 	Logger core.Logger
+	listener net.Listener // the listener when serving.
+	closed bool // whether the server is closed.
+	conns map[*Conn]bool // the serving connections.
+	serving sync.WaitGroup // the serving connections goroutines.
+	locker sync.Mutex
+}
+
+func NewServer(addr string, factory Factory) *Server {
+	server := &Server{Addr: addr, Factory: factory}
+	server.conns = make(map[*Conn]bool)
+	server.Logger = factory.CreateLogger("server", factory.SrsId())
+	return server
 }
 
 func (svr *Server) ListenAndServe() error {
@@ -51,23 +68,142 @@ func (svr *Server) ListenAndServe() error {
 }
 
 func (svr *Server) Serve(l net.Listener) error {
+	svr.locker.Lock()
+	if svr.closed {
+		svr.locker.Unlock()
+		l.Close()
+		return RtmpServerClosed
+	}
+	svr.listener = l
+	svr.locker.Unlock()
+
 	defer l.Close()
 	for {
 		rw, err := l.Accept()
 		if err != nil {
+			if svr.isClosed() {
+				svr.Logger.Trace("server %v closed", svr.Addr)
+				return RtmpServerClosed
+			}
 			if ne, ok := err.(net.Error); ok && ne.Temporary() {
 				continue
 			}
 			return err
 		}
 
+		// reject the connection before handshake, for example, exceed the max connections.
+		ip := rw.RemoteAddr().String()
+		if host, _, err := net.SplitHostPort(ip); err == nil {
+			ip = host
+		}
+		if err := svr.Factory.OnAccept(ip); err != nil {
+			svr.Logger.Warn("reject client ip=%v, %v", ip, err)
+			rw.Close()
+			continue
+		}
+
 		c := NewConn(svr, rw.(*net.TCPConn))
-		go c.Serve()
+		if !svr.addConn(c) {
+			svr.Factory.OnRelease(ip)
+			rw.Close()
+			return RtmpServerClosed
+		}
+		go func(){
+			defer svr.Factory.OnRelease(ip)
+			defer svr.removeConn(c)
+			c.Serve()
+		}()
+	}
+}
+
+// add the serving connection, false when server closed.
+func (svr *Server) addConn(c *Conn) bool {
+	svr.locker.Lock()
+	defer svr.locker.Unlock()
+
+	if svr.closed {
+		return false
+	}
+	svr.conns[c] = true
+	svr.serving.Add(1)
+	return true
+}
+
+func (svr *Server) removeConn(c *Conn) {
+	svr.locker.Lock()
+	defer svr.locker.Unlock()
+
+	delete(svr.conns, c)
+	svr.serving.Done()
+}
+
+// get the serving connections.
+func (svr *Server) Conns() (v []*Conn) {
+	svr.locker.Lock()
+	defer svr.locker.Unlock()
+
+	for c := range svr.conns {
+		v = append(v, c)
+	}
+	return
+}
+
+// stop accept new connections, the Serve will return RtmpServerClosed.
+func (svr *Server) Close() (err error) {
+	svr.locker.Lock()
+	defer svr.locker.Unlock()
+
+	svr.closed = true
+	if svr.listener != nil {
+		err = svr.listener.Close()
 	}
+	return
+}
+
+/**
+* shutdown the server gracefully, stop accept new connections,
+* close all connections and wait for them to quit,
+* when ctx done, force to close the connections, wait for them to quit and return ctx.Err().
+*/
+func (svr *Server) Shutdown(ctx context.Context) (err error) {
+	svr.Close()
+
+	conns := svr.Conns()
+	for _,c := range conns {
+		c.Close()
+	}
+	svr.Logger.Trace("server %v shutdown, wait for %v connections", svr.Addr, len(conns))
+
+	done := make(chan int)
+	go func(){
+		svr.serving.Wait()
+		close(done)
+	}()
+
+	select {
+	case <- done:
+		return
+	case <- ctx.Done():
+	}
+
+	// force to close the connections which not quit in time.
+	conns = svr.Conns()
+	svr.Logger.Warn("server %v shutdown timeout, force close %v connections", svr.Addr, len(conns))
+	for _,c := range conns {
+		c.IoRw.Close()
+	}
+
+	// the serving goroutines quit when socket closed.
+	<- done
+	return ctx.Err()
+}
+
+func (svr *Server) isClosed() bool {
+	svr.locker.Lock()
+	defer svr.locker.Unlock()
+	return svr.closed
 }
 
 func ListenAndServe(addr string, factory Factory) error {
-	server := &Server{Addr: addr, Factory: factory}
-	server.Logger = factory.CreateLogger("server", factory.SrsId())
-	return server.ListenAndServe()
+	return NewServer(addr, factory).ListenAndServe()
 }
@@ -27,3 +27,11 @@ type Stage interface {
     ConsumeMessage(msg *RtmpMessage) error
     Cleanup() // do cleanup for stage.
 }
+
+/**
+* the stage which notify the client before the connection kicked,
+* for example, the playing stage send the NetStream.Play.Stop.
+*/
+type KickedStage interface {
+    OnKicked() error
+}
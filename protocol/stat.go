@@ -0,0 +1,146 @@
+/*
+The MIT License (MIT)
+
+Copyright (c) 2013-2014 winlin
+
+Permission is hereby granted, free of charge, to any person obtaining a copy of
+this software and associated documentation files (the "Software"), to deal in
+the Software without restriction, including without limitation the rights to
+use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+the Software, and to permit persons to whom the Software is furnished to do so,
+subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+*/
+
+package protocol
+
+import (
+    "io"
+    "net"
+    "sync"
+    "sync/atomic"
+)
+
+// the reason of handshake failure, for the metrics.
+const (
+    HandshakeTimeout = "timeout"
+    HandshakeEOF = "eof"
+    HandshakePlainRequired = "plain_required"
+    HandshakeIOError = "io_error"
+)
+
+/**
+* the counters of all connections, for the metrics,
+* @remark all methods are safe in any goroutine.
+*/
+type Stat struct {
+    recvMessages int64
+    sendMessages int64
+    // the messages dropped for channel full.
+    droppedSource int64
+    droppedPump int64
+    // the handshake failures, key is the reason.
+    handshakeFailures map[string]int64
+    // the rejected publish or play, key is the action and reason.
+    rejections map[RejectKey]int64
+    locker sync.Mutex
+}
+
+// the key of rejections, for example, publish rejected for ip_denied.
+type RejectKey struct {
+    Action string
+    Reason string
+}
+
+// the counters of server.
+var ServerStat = &Stat{handshakeFailures: map[string]int64{}, rejections: map[RejectKey]int64{}}
+
+func (v *Stat) onRecvMessage() {
+    atomic.AddInt64(&v.recvMessages, 1)
+}
+
+func (v *Stat) onSendMessage() {
+    atomic.AddInt64(&v.sendMessages, 1)
+}
+
+func (v *Stat) onDropSourceMessage() {
+    atomic.AddInt64(&v.droppedSource, 1)
+}
+
+func (v *Stat) onDropPumpMessage() {
+    atomic.AddInt64(&v.droppedPump, 1)
+}
+
+// classify the handshake error to reason, to keep the metric labels few.
+func (v *Stat) onHandshakeFailed(err error) {
+    reason := HandshakeIOError
+    if ne, ok := err.(net.Error); ok && ne.Timeout() {
+        reason = HandshakeTimeout
+    } else if err == io.EOF || err == io.ErrUnexpectedEOF {
+        reason = HandshakeEOF
+    } else if err == RtmpPlainRequired {
+        reason = HandshakePlainRequired
+    }
+
+    v.locker.Lock()
+    defer v.locker.Unlock()
+    v.handshakeFailures[reason]++
+}
+
+// when the action of client rejected, for example, the play token expired.
+func (v *Stat) OnRejected(action, reason string) {
+    v.locker.Lock()
+    defer v.locker.Unlock()
+    v.rejections[RejectKey{action, reason}]++
+}
+
+func (v *Stat) RecvMessages() int64 {
+    return atomic.LoadInt64(&v.recvMessages)
+}
+
+func (v *Stat) SendMessages() int64 {
+    return atomic.LoadInt64(&v.sendMessages)
+}
+
+// the messages dropped by EnqueueSourceMessage for the out channel full.
+func (v *Stat) DroppedSourceMessages() int64 {
+    return atomic.LoadInt64(&v.droppedSource)
+}
+
+// the messages dropped by pumpMessage for the in channel full.
+func (v *Stat) DroppedPumpMessages() int64 {
+    return atomic.LoadInt64(&v.droppedPump)
+}
+
+// get a copy of the handshake failures, key is the reason.
+func (v *Stat) HandshakeFailures() map[string]int64 {
+    v.locker.Lock()
+    defer v.locker.Unlock()
+
+    r := map[string]int64{}
+    for k,n := range v.handshakeFailures {
+        r[k] = n
+    }
+    return r
+}
+
+// get a copy of the rejections.
+func (v *Stat) Rejections() map[RejectKey]int64 {
+    v.locker.Lock()
+    defer v.locker.Unlock()
+
+    r := map[RejectKey]int64{}
+    for k,n := range v.rejections {
+        r[k] = n
+    }
+    return r
+}
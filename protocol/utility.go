@@ -38,18 +38,63 @@ func RandomGenerate (r *rand.Rand, b []byte) {
     }
 }
 
-func DiscoveryTcUrl(tcUrl string, logger core.Logger) (schema, host, vhost, app string, port int, param string, err error) {
-    rawurl := tcUrl
+/**
+* parse the ...vhost... to standard query ?vhost= or &vhost=,
+* for some client cannot pass query string in tcUrl or stream.
+* for example:
+*       app...vhost...demo         => app?vhost=demo
+*       app?key=v...vhost...demo   => app?key=v&vhost=demo
+*/
+func NormalizeQuery(s string) string {
+    for strings.Index(s, "...") >= 0 {
+        if strings.Index(s, "?") >= 0 {
+            s = strings.Replace(s, "...", "&", 1)
+        } else {
+            s = strings.Replace(s, "...", "?", 1)
+        }
+        s = strings.Replace(s, "...", "=", 1)
+    }
+    return s
+}
+
+/**
+* parse the stream name of play or publish, which maybe:
+*       livestream
+*       livestream?token=abc&vhost=demo
+*       livestream...vhost...demo
+*       livestream.flv
+*       mp4:livestream.mp4
+* @return the stream without extension and the param without '?'.
+*/
+func DiscoveryStreamName(streamName string, logger core.Logger) (stream, param string) {
+    stream = strings.TrimSpace(NormalizeQuery(streamName))
 
-    // parse the ...vhost... to standard query &vhost=
-    for strings.Index(rawurl, "...") >= 0 {
-        rawurl = strings.Replace(rawurl, "...", "&", 1)
-        rawurl = strings.Replace(rawurl, "...", "=", 1)
+    if pos := strings.Index(stream, "?"); pos >= 0 {
+        param = stream[pos + 1:]
+        stream = stream[0:pos]
     }
 
+    // remove the flash prefix, for example, mp4:livestream.mp4
+    for _,v := range []string{"flv:", "mp4:"} {
+        stream = strings.TrimPrefix(stream, v)
+    }
+    // remove the extension, for example, livestream.flv
+    for _,v := range []string{".flv", ".mp4"} {
+        stream = strings.TrimSuffix(stream, v)
+    }
+    stream = strings.Trim(stream, "/")
+
+    logger.Info("stream name %v parsed to stream=%v, param=%v", streamName, stream, param)
+    return
+}
+
+func DiscoveryTcUrl(tcUrl string, logger core.Logger) (schema, host, vhost, app string, port int, param string, err error) {
+    // parse the ...vhost... to standard query ?vhost=
+    rawurl := NormalizeQuery(tcUrl)
+
     // use url module to parse.
     var uri *url.URL
-    if uri,err = url.Parse(tcUrl); err != nil {
+    if uri,err = url.Parse(rawurl); err != nil {
         logger.Error("parse tcUrl=%v failed", tcUrl)
         return
     }
@@ -0,0 +1,268 @@
+/*
+The MIT License (MIT)
+
+Copyright (c) 2013-2014 winlin
+
+Permission is hereby granted, free of charge, to any person obtaining a copy of
+this software and associated documentation files (the "Software"), to deal in
+the Software without restriction, including without limitation the rights to
+use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+the Software, and to permit persons to whom the Software is furnished to do so,
+subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+*/
+
+package rtmp
+
+import (
+    "bytes"
+    "fmt"
+    "github.com/cittu/go-srs/protocol"
+)
+
+/**
+* the codec of flv tag, parsed from the sequence header,
+* @see: E.4.2 Audio Tags, video_file_format_spec_v10_1.pdf, page 76
+* @see: E.4.3 Video Tags, video_file_format_spec_v10_1.pdf, page 78
+*/
+const (
+    // the video codec id.
+    FlvVideoCodecSorensonH263 = 2
+    FlvVideoCodecScreenVideo = 3
+    FlvVideoCodecOn2VP6 = 4
+    FlvVideoCodecOn2VP6Alpha = 5
+    FlvVideoCodecScreenVideo2 = 6
+    FlvVideoCodecAVC = 7
+
+    // the audio sound format.
+    FlvAudioCodecLinearPCM = 0
+    FlvAudioCodecADPCM = 1
+    FlvAudioCodecMP3 = 2
+    FlvAudioCodecLinearPCMLe = 3
+    FlvAudioCodecNellymoser16kHz = 4
+    FlvAudioCodecNellymoser8kHz = 5
+    FlvAudioCodecNellymoser = 6
+    FlvAudioCodecAAC = 10
+    FlvAudioCodecSpeex = 11
+
+    // the packet type of avc and aac.
+    flvSequenceHeader = 0
+)
+
+// the sample rate of aac, index by the samplingFrequencyIndex.
+var aacSampleRates = []int{
+    96000, 88200, 64000, 48000, 44100, 32000,
+    24000, 22050, 16000, 12000, 11025, 8000, 7350,
+}
+
+// the sample rate of flv audio tag, index by the SoundRate.
+var flvSampleRates = []int{5512, 11025, 22050, 44100}
+
+/**
+* the codec info of stream, for the api to query,
+* the zero value is unknown.
+*/
+type RtmpCodec struct {
+    VideoCodec int
+    // the avc profile_idc and level_idc, for example, 100(High) and 31(3.1).
+    AvcProfile int
+    AvcLevel int
+
+    AudioCodec int
+    // the aac audioObjectType, for example, 2(LC).
+    AacObject int
+    SampleRate int
+    Channels int
+    // the video frame rate, parsed from metadata, 0 if unknown.
+    FrameRate int
+
+    // whether got the video or audio packet.
+    hasVideo bool
+    hasAudio bool
+}
+
+func (codec *RtmpCodec) HasVideo() bool {
+    return codec.hasVideo
+}
+
+func (codec *RtmpCodec) HasAudio() bool {
+    return codec.hasAudio
+}
+
+// parse the flv video tag, update the codec when got sequence header.
+func (codec *RtmpCodec) demuxVideo(b []byte) {
+    if len(b) < 1 {
+        return
+    }
+    codec.hasVideo = true
+    codec.VideoCodec = int(b[0] & 0x0f)
+
+    // 1bytes avc packet type, 3bytes cts, then AVCDecoderConfigurationRecord
+    // which the profile is at 1, and level is at 3.
+    // @see: 5.3.3.1.2 Syntax, H.264-AVC-ISO_IEC_14496-15.pdf, page 16
+    if codec.VideoCodec != FlvVideoCodecAVC || len(b) < 9 || b[1] != flvSequenceHeader {
+        return
+    }
+    codec.AvcProfile = int(b[6])
+    codec.AvcLevel = int(b[8])
+}
+
+// parse the flv audio tag, update the codec when got sequence header.
+func (codec *RtmpCodec) demuxAudio(b []byte) {
+    if len(b) < 1 {
+        return
+    }
+    codec.hasAudio = true
+    codec.AudioCodec = int(b[0] >> 4) & 0x0f
+
+    if codec.AudioCodec != FlvAudioCodecAAC {
+        codec.SampleRate = flvSampleRates[(b[0] >> 2) & 0x03]
+        codec.Channels = int(b[0] & 0x01) + 1
+        return
+    }
+
+    // 1bytes aac packet type, then AudioSpecificConfig,
+    // 5bits audioObjectType, 4bits samplingFrequencyIndex, 4bits channelConfiguration.
+    // @see: 1.6.2.1 AudioSpecificConfig, aac-mp4a-format-ISO_IEC_14496-3+2001.pdf, page 33
+    if len(b) < 4 || b[1] != flvSequenceHeader {
+        return
+    }
+    codec.AacObject = int(b[2] >> 3) & 0x1f
+    if index := int(b[2] & 0x07) << 1 | int(b[3] >> 7) & 0x01; index < len(aacSampleRates) {
+        codec.SampleRate = aacSampleRates[index]
+    }
+    codec.Channels = int(b[3] >> 3) & 0x0f
+}
+
+// whether the flv video tag is keyframe, the frame type is 1.
+func isVideoKeyframe(b []byte) bool {
+    return len(b) > 0 && (b[0] >> 4) & 0x0f == 1
+}
+
+// whether the flv video tag is the avc sequence header.
+func isVideoSequenceHeader(b []byte) bool {
+    return isVideoKeyframe(b) && b[0] & 0x0f == FlvVideoCodecAVC && len(b) > 1 && b[1] == flvSequenceHeader
+}
+
+// whether the flv audio tag is the aac sequence header.
+func isAudioSequenceHeader(b []byte) bool {
+    return len(b) > 1 && (b[0] >> 4) & 0x0f == FlvAudioCodecAAC && b[1] == flvSequenceHeader
+}
+
+/**
+* parse the onMetaData of AMF0 data message, update the frame rate,
+* and the sample rate which is overwritten by the sequence header,
+* for example, @setDataFrame("onMetaData", {framerate:25, audiosamplerate:44100}).
+* @return the onMetaData without the @setDataFrame for player, nil if not metadata.
+*/
+func (codec *RtmpCodec) demuxMetadata(b []byte) (metadata []byte) {
+    buffer := bytes.NewBuffer(b)
+
+    name,err := protocol.DecodeAmf0String(buffer)
+    if err == nil && name == protocol.RTMP_AMF0_DATA_SET_DATAFRAME {
+        b = b[len(b) - buffer.Len():]
+        name,err = protocol.DecodeAmf0String(buffer)
+    }
+    if err != nil || name != protocol.RTMP_AMF0_DATA_ON_METADATA {
+        return
+    }
+    metadata = b
+
+    var any protocol.Amf0Any
+    if any,err = protocol.DecodeAmf0Any(buffer); err != nil {
+        return
+    }
+
+    // the metadata maybe object or ecma array.
+    var values interface{
+        GetNumber(name string) (v protocol.Amf0Number, ok bool)
+    }
+    switch v := any.(type) {
+    case *protocol.Amf0Object:
+        values = v
+    case *protocol.Amf0EcmaArray:
+        values = v
+    default:
+        return
+    }
+
+    if v,ok := values.GetNumber("framerate"); ok && v > 0 {
+        codec.FrameRate = int(v)
+    }
+    if v,ok := values.GetNumber("audiosamplerate"); ok && v > 0 {
+        codec.SampleRate = int(v)
+    }
+    return
+}
+
+// the name of video codec, for example, H264.
+func VideoCodecName(codec int) string {
+    switch codec {
+    case FlvVideoCodecSorensonH263: return "H263"
+    case FlvVideoCodecScreenVideo: return "Screen"
+    case FlvVideoCodecOn2VP6: return "VP6"
+    case FlvVideoCodecOn2VP6Alpha: return "VP6Alpha"
+    case FlvVideoCodecScreenVideo2: return "Screen2"
+    case FlvVideoCodecAVC: return "H264"
+    }
+    return "Other"
+}
+
+// the name of audio codec, for example, AAC.
+func AudioCodecName(codec int) string {
+    switch codec {
+    case FlvAudioCodecLinearPCM, FlvAudioCodecLinearPCMLe: return "PCM"
+    case FlvAudioCodecADPCM: return "ADPCM"
+    case FlvAudioCodecMP3: return "MP3"
+    case FlvAudioCodecNellymoser16kHz, FlvAudioCodecNellymoser8kHz, FlvAudioCodecNellymoser: return "Nellymoser"
+    case FlvAudioCodecAAC: return "AAC"
+    case FlvAudioCodecSpeex: return "Speex"
+    }
+    return "Other"
+}
+
+// the name of avc profile, for example, High.
+func AvcProfileName(profile int) string {
+    switch profile {
+    case 66: return "Baseline"
+    case 77: return "Main"
+    case 88: return "Extended"
+    case 100: return "High"
+    case 110: return "High10"
+    case 122: return "High422"
+    case 244: return "High444"
+    }
+    return "Other"
+}
+
+// the name of avc level, for example, 3.1.
+func AvcLevelName(level int) string {
+    if level <= 0 {
+        return "Other"
+    }
+    if level % 10 == 0 {
+        return fmt.Sprintf("%d", level / 10)
+    }
+    return fmt.Sprintf("%d.%d", level / 10, level % 10)
+}
+
+// the name of aac object, for example, LC.
+func AacObjectName(object int) string {
+    switch object {
+    case 1: return "Main"
+    case 2: return "LC"
+    case 3: return "SSR"
+    case 5: return "HE"
+    case 29: return "HEv2"
+    }
+    return "Other"
+}
@@ -29,12 +29,14 @@ import (
     "log"
     "github.com/cittu/go-srs/core"
     "github.com/cittu/go-srs/protocol"
+    "github.com/cittu/go-srs/config"
+    "time"
+    "sync/atomic"
 )
 
-var goroutineIdSeed int = 99
+var goroutineIdSeed int32 = 99
 func goroutineId() int {
-    goroutineIdSeed += 1
-    return goroutineIdSeed
+    return int(atomic.AddInt32(&goroutineIdSeed, 1))
 }
 
 type Factory struct {
@@ -46,20 +48,30 @@ func (f *Factory) SrsId() int {
 
 func (f *Factory) CreateLogger(name string, srsId int) core.Logger {
     v := &Logger{}
+    v.Name = name
     v.GoroutineId = srsId
-    //v.Flag = log.Ldate | log.Ltime | core.Linfo | core.Ltrace | core.Lwarn | core.Lerror
-    v.Flag = log.Ldate | log.Ltime | core.Ltrace | core.Lwarn | core.Lerror
-    // TODO: FIXME: apply config file.
+    v.Flag = log.Ldate | log.Ltime
     prefix := fmt.Sprintf("[%s][%d][%d] ", name, os.Getpid(), v.GoroutineId)
-    v.Logger = log.New(os.Stdout, prefix, v.Flag)
+    v.Logger = log.New(logOutput, prefix, v.Flag)
     return v
 }
 
 // interface core.Factory
 func (f *Factory) NewConnectStage(conn *protocol.Conn) protocol.Stage {
+    // the client must connect and identify in time.
+    conn.SetTimeout(config.Get().ConnectTimeout(), "connect")
     return &connectStage{conn:conn,}
 }
 
 func (f *Factory) NewIdenfityStage(conn *protocol.Conn) protocol.Stage {
+    // when republish, the client must identify in time, and the send timeout
+    // of player is not used, the next stream stage sets its own.
+    conn.SetTimeout(config.Get().ConnectTimeout(), "identify")
+    conn.SetSendTimeout(0)
+    conn.SetClientInfo(protocol.RtmpClientUnknown)
     return &identifyClientStage{conn:conn,}
 }
+
+func (f *Factory) HandshakeTimeout() time.Duration {
+    return config.Get().HandshakeTimeout()
+}
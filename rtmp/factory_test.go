@@ -0,0 +1,62 @@
+/*
+The MIT License (MIT)
+
+Copyright (c) 2013-2014 winlin
+
+Permission is hereby granted, free of charge, to any person obtaining a copy of
+this software and associated documentation files (the "Software"), to deal in
+the Software without restriction, including without limitation the rights to
+use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+the Software, and to permit persons to whom the Software is furnished to do so,
+subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+*/
+
+package rtmp
+
+import (
+    "testing"
+    "time"
+    "github.com/cittu/go-srs/config"
+    "github.com/cittu/go-srs/protocol"
+)
+
+func TestIdentifyStageTimeout(t *testing.T) {
+    c,err := config.LoadDefault()
+    if err != nil {
+        t.Fatalf("load default config failed, err is %v", err)
+    }
+    defer config.Set(config.Get())
+    config.Set(c)
+
+    // the player closeStream, which stop the receive timeout and set the send timeout.
+    conn := &protocol.Conn{Logger: CreateLogger("test")}
+    conn.SetTimeout(0, "")
+    conn.SetSendTimeout(3 * time.Second)
+
+    starttime := time.Now()
+    f := &Factory{}
+    if _,ok := f.NewIdenfityStage(conn).(*identifyClientStage); !ok {
+        t.Fatalf("republish must retry the identify stage")
+    }
+
+    deadline,reason := conn.Timeout()
+    if reason != "identify" {
+        t.Errorf("timeout reason must be identify, actual %v", reason)
+    }
+    if deadline.Before(starttime.Add(c.ConnectTimeout())) || deadline.After(time.Now().Add(c.ConnectTimeout())) {
+        t.Errorf("identify must timeout in %v, actual %v", c.ConnectTimeout(), deadline.Sub(starttime))
+    }
+    if v := conn.SendTimeout(); v != 0 {
+        t.Errorf("send timeout must be cleared, actual %v", v)
+    }
+}
@@ -0,0 +1,119 @@
+/*
+The MIT License (MIT)
+
+Copyright (c) 2013-2014 winlin
+
+Permission is hereby granted, free of charge, to any person obtaining a copy of
+this software and associated documentation files (the "Software"), to deal in
+the Software without restriction, including without limitation the rights to
+use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+the Software, and to permit persons to whom the Software is furnished to do so,
+subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+*/
+
+package rtmp
+
+import (
+    "github.com/cittu/go-srs/protocol"
+)
+
+/**
+* the max audio messages to cache for pure audio stream,
+* clear the cache when exceed, for there is no keyframe to start a new gop.
+* about 3s for aac in 44.1kHz, each frame in 23ms.
+*/
+const pureAudioGuessCount = 115
+
+/**
+* the max messages to cache, clear the cache when exceed,
+* for the gop is too large, for example, the encoder never sends keyframe.
+* about 40s for video in 25fps and aac in 44.1kHz.
+*/
+const gopCacheMaxMessages = 2500
+
+/**
+* the gop cache of source, cache the messages from the last keyframe,
+* to fast startup the player, which can decode the video immediately.
+* @remark the metadata and sequence headers are cached by source, not the gop cache.
+*/
+type RtmpGopCache struct {
+    enabled bool
+    // the video frames in cache, 0 for pure audio.
+    videoCount int
+    msgs []*protocol.RtmpMessage
+    // the bytes of payload in cache.
+    bytes int
+}
+
+// enable or disable the gop cache, clear the cache when disabled.
+func (gop *RtmpGopCache) Set(enabled bool) {
+    gop.enabled = enabled
+    if !enabled {
+        gop.Clear()
+    }
+}
+
+func (gop *RtmpGopCache) Enabled() bool {
+    return gop.enabled
+}
+
+// cache the audio or video message, ignore the others.
+func (gop *RtmpGopCache) Cache(msg *protocol.RtmpMessage) {
+    if !gop.enabled {
+        return
+    }
+
+    if msg.Header.IsVideo() {
+        // start a new gop at keyframe, drop the frames before the first keyframe.
+        if isVideoKeyframe(msg.Payload) {
+            gop.Clear()
+        } else if gop.videoCount == 0 {
+            return
+        }
+        gop.videoCount++
+    } else if msg.Header.IsAudio() {
+        // clear the pure audio cache when exceed.
+        if gop.videoCount == 0 && len(gop.msgs) >= pureAudioGuessCount {
+            gop.Clear()
+        }
+    } else {
+        return
+    }
+
+    // clear the large gop, cache again from the next keyframe.
+    if len(gop.msgs) >= gopCacheMaxMessages {
+        gop.Clear()
+        if msg.Header.IsVideo() {
+            return
+        }
+    }
+
+    gop.msgs = append(gop.msgs, msg)
+    gop.bytes += len(msg.Payload)
+}
+
+func (gop *RtmpGopCache) Clear() {
+    gop.videoCount = 0
+    gop.msgs = nil
+    gop.bytes = 0
+}
+
+// the cached messages, the first video is keyframe.
+func (gop *RtmpGopCache) Messages() []*protocol.RtmpMessage {
+    return gop.msgs
+}
+
+// the number of cached messages and the bytes of payload.
+func (gop *RtmpGopCache) Size() (msgs, bytes int) {
+    return len(gop.msgs), gop.bytes
+}
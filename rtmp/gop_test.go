@@ -0,0 +1,169 @@
+/*
+The MIT License (MIT)
+
+Copyright (c) 2013-2014 winlin
+
+Permission is hereby granted, free of charge, to any person obtaining a copy of
+this software and associated documentation files (the "Software"), to deal in
+the Software without restriction, including without limitation the rights to
+use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+the Software, and to permit persons to whom the Software is furnished to do so,
+subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+*/
+
+package rtmp
+
+import (
+    "bytes"
+    "testing"
+    "github.com/cittu/go-srs/config"
+    "github.com/cittu/go-srs/protocol"
+)
+
+func TestRtmpGopCache(t *testing.T) {
+    const audio, video = protocol.RTMP_MSG_AudioMessage, protocol.RTMP_MSG_VideoMessage
+    // the avc keyframe, interframe and aac raw data.
+    keyframe, interframe, aac := []byte{0x17, 0x01}, []byte{0x27, 0x01}, []byte{0xaf, 0x01}
+
+    newMsg := func(messageType int8, payload []byte) *protocol.RtmpMessage {
+        msg := &protocol.RtmpMessage{Payload: payload}
+        msg.Header.MessageType = messageType
+        return msg
+    }
+
+    cases := []struct {
+        name string
+        enabled bool
+        msgs []*protocol.RtmpMessage
+        // the expect cached messages and bytes.
+        count int
+        bytes int
+    }{
+        {"disabled", false, []*protocol.RtmpMessage{newMsg(video, keyframe), newMsg(audio, aac)}, 0, 0},
+        {"drop before keyframe", true, []*protocol.RtmpMessage{newMsg(video, interframe), newMsg(video, keyframe), newMsg(audio, aac)}, 2, 4},
+        {"new gop at keyframe", true, []*protocol.RtmpMessage{
+            newMsg(video, keyframe), newMsg(video, interframe), newMsg(audio, aac), newMsg(video, keyframe), newMsg(video, interframe),
+        }, 2, 4},
+        {"ignore data", true, []*protocol.RtmpMessage{newMsg(video, keyframe), newMsg(protocol.RTMP_MSG_AMF0DataMessage, []byte{0x02})}, 1, 2},
+    }
+
+    for _,c := range cases {
+        gop := &RtmpGopCache{}
+        gop.Set(c.enabled)
+        for _,msg := range c.msgs {
+            gop.Cache(msg)
+        }
+        if count,bytes := gop.Size(); count != c.count || bytes != c.bytes {
+            t.Errorf("%v: expect %v msgs %v bytes, actual %v msgs %v bytes", c.name, c.count, c.bytes, count, bytes)
+        }
+        if v := gop.Messages(); len(v) > 0 && v[0].Header.IsVideo() && !isVideoKeyframe(v[0].Payload) {
+            t.Errorf("%v: the first video must be keyframe", c.name)
+        }
+    }
+
+    // the pure audio stream, clear when exceed.
+    gop := &RtmpGopCache{}
+    gop.Set(true)
+    for i := 0; i < pureAudioGuessCount + 10; i++ {
+        gop.Cache(newMsg(audio, aac))
+    }
+    if count,_ := gop.Size(); count != 10 {
+        t.Errorf("pure audio expect 10 msgs, actual %v", count)
+    }
+
+    // the large gop, clear and cache from the next keyframe.
+    gop.Clear()
+    for i := 0; i < gopCacheMaxMessages + 10; i++ {
+        if i == 0 {
+            gop.Cache(newMsg(video, keyframe))
+        } else {
+            gop.Cache(newMsg(video, interframe))
+        }
+    }
+    if count,_ := gop.Size(); count != 0 {
+        t.Errorf("large gop expect empty until keyframe, actual %v", count)
+    }
+    gop.Cache(newMsg(video, keyframe))
+    if count,_ := gop.Size(); count != 1 {
+        t.Errorf("cache from the next keyframe, actual %v", count)
+    }
+
+    // clear the cache when disabled.
+    gop.Set(false)
+    if count,_ := gop.Size(); count != 0 {
+        t.Errorf("disabled expect empty, actual %v", count)
+    }
+}
+
+func TestRtmpSequenceHeader(t *testing.T) {
+    if !isVideoSequenceHeader([]byte{0x17, 0x00}) || isVideoSequenceHeader([]byte{0x17, 0x01}) || isVideoSequenceHeader([]byte{0x27, 0x00}) {
+        t.Errorf("avc sequence header is keyframe with packet type 0")
+    }
+    if !isAudioSequenceHeader([]byte{0xaf, 0x00}) || isAudioSequenceHeader([]byte{0xaf, 0x01}) || isAudioSequenceHeader([]byte{0x2f, 0x00}) {
+        t.Errorf("aac sequence header is packet type 0")
+    }
+}
+
+func TestRtmpSourceMetadata(t *testing.T) {
+    c,err := config.LoadDefault()
+    if err != nil {
+        t.Fatalf("load default config failed, err is %v", err)
+    }
+    defer config.Set(config.Get())
+    config.Set(c)
+
+    logger := CreateLogger("test")
+    req := &protocol.RtmpRequest{Vhost: "__defaultVhost__", App: "live", Stream: "metadata"}
+    source,err := FindSource(&protocol.Conn{}, req, logger)
+    if err != nil {
+        t.Fatalf("find source failed, err is %v", err)
+    }
+    defer releaseSource(source, logger)
+
+    // the encoder publish the metadata by @setDataFrame.
+    metadata := protocol.NewAmf0EcmaArray()
+    metadata.Set("framerate", protocol.Amf0Number(25))
+    b := &bytes.Buffer{}
+    protocol.EncodeAmf0String(b, "@setDataFrame")
+    protocol.EncodeAmf0String(b, "onMetaData")
+    protocol.EncodeAmf0Any(b, metadata)
+    msg := &protocol.RtmpMessage{Payload: b.Bytes()}
+    msg.Header.MessageType = protocol.RTMP_MSG_AMF0DataMessage
+    if err = source.OnMessage(msg); err != nil {
+        t.Fatalf("source process metadata failed, err is %v", err)
+    }
+
+    // the new consumer got the onMetaData first.
+    conn := &protocol.Conn{Logger: logger, OutChannel: make(chan *protocol.RtmpMessage, 8)}
+    source.CreateConsumer(conn)
+    if len(conn.OutChannel) != 1 {
+        t.Fatalf("expect 1 cached msg, actual %v", len(conn.OutChannel))
+    }
+    v := <-conn.OutChannel
+    name,err := protocol.DecodeAmf0String(bytes.NewBuffer(v.Payload))
+    if !v.Header.IsAmf0Data() || err != nil || name != "onMetaData" {
+        t.Errorf("expect onMetaData, actual %v, err is %v", name, err)
+    }
+    if int(v.Header.PayloadLength) != len(v.Payload) {
+        t.Errorf("expect payload length %v, actual %v", len(v.Payload), v.Header.PayloadLength)
+    }
+
+    // the metadata is cleared when unpublish.
+    source.DestroyConsumer(conn)
+    source.OnUnPublish()
+    conn = &protocol.Conn{Logger: logger, OutChannel: make(chan *protocol.RtmpMessage, 8)}
+    source.CreateConsumer(conn)
+    if len(conn.OutChannel) != 0 {
+        t.Errorf("expect no cached msg, actual %v", len(conn.OutChannel))
+    }
+}
@@ -0,0 +1,202 @@
+/*
+The MIT License (MIT)
+
+Copyright (c) 2013-2014 winlin
+
+Permission is hereby granted, free of charge, to any person obtaining a copy of
+this software and associated documentation files (the "Software"), to deal in
+the Software without restriction, including without limitation the rights to
+use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+the Software, and to permit persons to whom the Software is furnished to do so,
+subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+*/
+
+package rtmp
+
+import (
+    "io"
+    "fmt"
+    "bytes"
+    "context"
+    "errors"
+    "strconv"
+    "strings"
+    "sync"
+    "net/http"
+    "io/ioutil"
+    "encoding/json"
+    "github.com/cittu/go-srs/protocol"
+    "github.com/cittu/go-srs/config"
+)
+
+var RtmpHookRejected = errors.New("rejected by http hooks")
+
+// the events of http hooks.
+const (
+    HookOnConnect = "on_connect"
+    HookOnClose = "on_close"
+    HookOnPublish = "on_publish"
+    HookOnUnpublish = "on_unpublish"
+    HookOnPlay = "on_play"
+    HookOnStop = "on_stop"
+)
+
+// the max size of http hooks response, which is the code.
+const hookMaxResponseSize = 4096
+
+/**
+* notify the backend by the http hooks of vhost,
+* POST the client and request in json to each url of event, for example:
+*       {"action":"on_publish","client_id":105,"ip":"127.0.0.1","vhost":"__defaultVhost__",
+*       "app":"live","stream":"livestream","param":"token=xxx","tcUrl":"rtmp://127.0.0.1/live",
+*       "pageUrl":"","swfUrl":""}
+* the backend must response http 200 with code 0, "0" or {"code":0}, to allow the action.
+* @param extra the extra fields of event, nil for none.
+* @return RtmpHookRejected when any url rejected or failed.
+* @remark the hook is synchronous, block until all urls responsed or timeout,
+*       use notifyHttpHook for the events which never reject.
+*/
+func onHttpHook(conn *protocol.Conn, event string, extra map[string]interface{}) (err error) {
+    return onHttpHookOf(conn, &conn.Request, event, extra)
+}
+
+// notify the http hooks by the specified request, for example, the previous vhost.
+func onHttpHookOf(conn *protocol.Conn, req *protocol.RtmpRequest, event string, extra map[string]interface{}) (err error) {
+    conf := config.Get()
+    logger := conn.Logger
+
+    urls := conf.VhostHttpHooks(req.Vhost, event)
+    if len(urls) == 0 {
+        return
+    }
+
+    body := map[string]interface{}{
+        "action": event,
+        "client_id": conn.SrsId,
+        "ip": conn.Ip,
+        "vhost": req.Vhost,
+        "app": req.App,
+        "stream": req.Stream,
+        "param": req.Param,
+        "tcUrl": req.TcUrl,
+        "pageUrl": req.PageUrl,
+        "swfUrl": req.SwfUrl,
+    }
+    for k,v := range extra {
+        body[k] = v
+    }
+
+    var data []byte
+    if data,err = json.Marshal(body); err != nil {
+        logger.Error("marshal http hook %v failed, err is %v", event, err)
+        return
+    }
+
+    client := &http.Client{Timeout: conf.VhostHttpHooksTimeout(req.Vhost)}
+    for _,url := range urls {
+        if err := postHttpHook(client, url, data); err != nil {
+            logger.Warn("http hook %v %v failed, err is %v", event, url, err)
+            return RtmpHookRejected
+        }
+        logger.Trace("http hook %v %v success", event, url)
+    }
+    return
+}
+
+// the http hooks notified in background, shutdown waits for them in grace period.
+var pendingHooks sync.WaitGroup
+
+/**
+* notify the backend by the http hooks in background, for the events which never reject,
+* for example, on_close, on_stop and on_unpublish, to not block the connection to quit.
+* @remark the request is copied, for the connection may serve another stream.
+*/
+func notifyHttpHook(conn *protocol.Conn, event string, extra map[string]interface{}) {
+    req := conn.Request
+    pendingHooks.Add(1)
+    go func(){
+        defer pendingHooks.Done()
+        onHttpHookOf(conn, &req, event, extra)
+    }()
+}
+
+// wait for the http hooks in background to complete, until ctx done.
+func waitHttpHooks(ctx context.Context) (err error) {
+    if err = ctx.Err(); err != nil {
+        return
+    }
+
+    done := make(chan bool)
+    go func(){
+        pendingHooks.Wait()
+        close(done)
+    }()
+
+    select {
+    case <-done:
+    case <-ctx.Done():
+        err = ctx.Err()
+    }
+    return
+}
+
+// the extra fields of on_close, the bytes of connection.
+func onCloseExtra(conn *protocol.Conn) map[string]interface{} {
+    return map[string]interface{}{
+        "send_bytes": conn.Kbps.SendBytes(),
+        "recv_bytes": conn.Kbps.RecvBytes(),
+    }
+}
+
+// post the data to url, error when http status not 200 or code not 0.
+func postHttpHook(client *http.Client, url string, data []byte) (err error) {
+    var res *http.Response
+    if res,err = client.Post(url, "application/json", bytes.NewReader(data)); err != nil {
+        return
+    }
+    defer res.Body.Close()
+
+    var b []byte
+    if b,err = ioutil.ReadAll(io.LimitReader(res.Body, hookMaxResponseSize)); err != nil {
+        return
+    }
+    if res.StatusCode != http.StatusOK {
+        return fmt.Errorf("http status %v", res.StatusCode)
+    }
+
+    // the response is the code, in number or string, or json object with code.
+    s := strings.TrimSpace(string(b))
+    var v interface{}
+    if err = json.Unmarshal([]byte(s), &v); err != nil {
+        return fmt.Errorf("invalid response %q", s)
+    }
+    if obj,ok := v.(map[string]interface{}); ok {
+        v = obj["code"]
+    }
+
+    var code float64
+    switch c := v.(type) {
+    case float64:
+        code = c
+    case string:
+        if code,err = strconv.ParseFloat(strings.TrimSpace(c), 64); err != nil {
+            return fmt.Errorf("invalid response %q", s)
+        }
+    default:
+        return fmt.Errorf("invalid response %q", s)
+    }
+    if code != 0 {
+        return fmt.Errorf("response code %v", code)
+    }
+    return
+}
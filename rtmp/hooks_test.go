@@ -0,0 +1,131 @@
+/*
+The MIT License (MIT)
+
+Copyright (c) 2013-2014 winlin
+
+Permission is hereby granted, free of charge, to any person obtaining a copy of
+this software and associated documentation files (the "Software"), to deal in
+the Software without restriction, including without limitation the rights to
+use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+the Software, and to permit persons to whom the Software is furnished to do so,
+subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+*/
+
+package rtmp
+
+import (
+    "context"
+    "encoding/json"
+    "net/http"
+    "net/http/httptest"
+    "testing"
+    "time"
+    "github.com/cittu/go-srs/config"
+    "github.com/cittu/go-srs/protocol"
+)
+
+func TestPostHttpHook(t *testing.T) {
+    cases := []struct {
+        name string
+        status int
+        body string
+        delay time.Duration
+        ok bool
+    }{
+        {"code 0", http.StatusOK, "0", 0, true},
+        {"code 0 with spaces", http.StatusOK, " 0\n", 0, true},
+        {"string code 0", http.StatusOK, `"0"`, 0, true},
+        {"object code 0", http.StatusOK, `{"code":0}`, 0, true},
+        {"object string code 0", http.StatusOK, `{"code":"0","data":{}}`, 0, true},
+        {"code 1", http.StatusOK, "1", 0, false},
+        {"object code 1", http.StatusOK, `{"code":1}`, 0, false},
+        {"object without code", http.StatusOK, `{"data":0}`, 0, false},
+        {"empty", http.StatusOK, "", 0, false},
+        {"plain text", http.StatusOK, "ok", 0, false},
+        {"non-200", http.StatusInternalServerError, "0", 0, false},
+        {"not found", http.StatusNotFound, `{"code":0}`, 0, false},
+        {"timeout", http.StatusOK, "0", 500 * time.Millisecond, false},
+    }
+
+    for _,c := range cases {
+        c := c
+        server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+            if r.Method != http.MethodPost || r.Header.Get("Content-Type") != "application/json" {
+                t.Errorf("%v: must post json, actual %v %v", c.name, r.Method, r.Header.Get("Content-Type"))
+            }
+            time.Sleep(c.delay)
+            w.WriteHeader(c.status)
+            w.Write([]byte(c.body))
+        }))
+
+        client := &http.Client{Timeout: 100 * time.Millisecond}
+        err := postHttpHook(client, server.URL, []byte(`{"action":"on_play"}`))
+        if c.ok && err != nil {
+            t.Errorf("%v: must allow, err is %v", c.name, err)
+        }
+        if !c.ok && err == nil {
+            t.Errorf("%v: must reject", c.name)
+        }
+        server.Close()
+    }
+}
+
+func TestNotifyHttpHook(t *testing.T) {
+    streams := make(chan string, 1)
+    server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        var body map[string]interface{}
+        json.NewDecoder(r.Body).Decode(&body)
+        time.Sleep(300 * time.Millisecond)
+        streams <- body["stream"].(string)
+        w.Write([]byte("0"))
+    }))
+    defer server.Close()
+
+    c,err := config.Parse("t.conf", []byte("vhost __defaultVhost__ { http_hooks { enabled on; on_stop " + server.URL + "; } }"))
+    if err != nil {
+        t.Fatalf("parse config failed, err is %v", err)
+    }
+    defer config.Set(config.Get())
+    config.Set(c)
+
+    conn := &protocol.Conn{Logger: CreateLogger("test")}
+    conn.Request = protocol.RtmpRequest{Vhost: "__defaultVhost__", App: "live", Stream: "livestream"}
+
+    // the hook never block the connection.
+    starttime := time.Now()
+    notifyHttpHook(conn, HookOnStop, nil)
+    if d := time.Since(starttime); d > 100 * time.Millisecond {
+        t.Errorf("notify must not block, actual %v", d)
+    }
+    conn.Request.Stream = "another"
+
+    // the shutdown wait for the hook in grace period.
+    ctx,cancel := context.WithTimeout(context.Background(), 50 * time.Millisecond)
+    defer cancel()
+    if err = waitHttpHooks(ctx); err != context.DeadlineExceeded {
+        t.Errorf("wait must timeout, err is %v", err)
+    }
+    if err = waitHttpHooks(context.Background()); err != nil {
+        t.Errorf("wait for hooks failed, err is %v", err)
+    }
+
+    // notify the request when the hook called.
+    select {
+    case v := <-streams:
+        if v != "livestream" {
+            t.Errorf("expect stream livestream, actual %v", v)
+        }
+    default:
+        t.Errorf("hook must be called when wait done")
+    }
+}
@@ -0,0 +1,188 @@
+/*
+The MIT License (MIT)
+
+Copyright (c) 2013-2014 winlin
+
+Permission is hereby granted, free of charge, to any person obtaining a copy of
+this software and associated documentation files (the "Software"), to deal in
+the Software without restriction, including without limitation the rights to
+use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+the Software, and to permit persons to whom the Software is furnished to do so,
+subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+*/
+
+package rtmp
+
+import (
+    "github.com/cittu/go-srs/core"
+    "github.com/cittu/go-srs/protocol"
+)
+
+/**
+* the time jitter algorithm:
+* 1. full, to ensure stream start at zero, and ensure stream monotonically increasing.
+* 2. zero, only ensure sttream start at zero, ignore timestamp jitter.
+* 3. off, disable the time jitter algorithm, like atc.
+*/
+const (
+    RtmpJitterFull = 0x01 + iota
+    RtmpJitterZero
+    RtmpJitterOff
+)
+
+const (
+    // the max jitter in ms, when exceed, reset the delta.
+    RtmpMaxJitterMs = 250
+    RtmpMaxJitterMsNeg = -250
+    // the default delta in ms when jitter detected.
+    RtmpDefaultFrameTimeMs = 10
+)
+
+// parse the jitter algorithm from its name, default to full.
+func ParseJitterAlgorithm(v string) int {
+    switch v {
+    case "zero":
+        return RtmpJitterZero
+    case "off":
+        return RtmpJitterOff
+    }
+    return RtmpJitterFull
+}
+
+/**
+* time jitter detect and correct,
+* to ensure the rtmp stream is monotonically.
+*/
+type RtmpJitter struct {
+    lastPktTime int64
+    lastPktCorrectTime int64
+    // whether got the first packet of stream, reset when the stream republish.
+    started bool
+}
+
+func NewRtmpJitter() *RtmpJitter {
+    return &RtmpJitter{
+        lastPktTime: 0,
+        lastPktCorrectTime: -1,
+    }
+}
+
+/**
+* detect the time jitter and correct it.
+* @param tba, the audio timebase, used to calc the "right" delta if jitter detected.
+* @param tbv, the video timebase, used to calc the "right" delta if jitter detected.
+* @param ag the algorithm in RtmpJitterFull, RtmpJitterZero or RtmpJitterOff.
+* @remark the msg is modified, user must copy it when shared by consumers.
+*/
+func (jitter *RtmpJitter) Correct(msg *protocol.RtmpMessage, tba, tbv int, ag int, logger core.Logger) {
+    // for performance issue
+    if ag != RtmpJitterFull {
+        // all jitter correct features is disabled, ignore.
+        if ag == RtmpJitterOff {
+            return
+        }
+
+        // start at zero, but donot ensure monotonically increasing.
+        if ag == RtmpJitterZero {
+            // for the first packet of stream, use its time as the base.
+            if !jitter.started {
+                jitter.started = true
+                jitter.lastPktCorrectTime = msg.Header.Timestamp
+            }
+            msg.Header.Timestamp -= jitter.lastPktCorrectTime
+            return
+        }
+
+        // other algorithm, ignore.
+        return
+    }
+
+    // full jitter algorithm, do jitter correct.
+    // set to 0 for metadata.
+    if !msg.Header.IsAudio() && !msg.Header.IsVideo() {
+        msg.Header.Timestamp = 0
+        return
+    }
+
+    /**
+    * we use a very simple time jitter detect/correct algorithm:
+    * 1. delta: ensure the delta is positive and valid,
+    *     we set the delta to 0 if the delta is nagative but small,
+    *     or RtmpDefaultFrameTimeMs if less than RtmpMaxJitterMsNeg or greater than RtmpMaxJitterMs.
+    * 2. lastPktTime: specifies the original packet time,
+    *     is used to detect next jitter.
+    * 3. lastPktCorrectTime: simply add the positive delta,
+    *     and enforce the time monotonically.
+    */
+    time := msg.Header.Timestamp
+
+    // the first packet of stream starts at zero,
+    // or continues the last time with the default delta when republish.
+    if !jitter.started {
+        jitter.started = true
+        if jitter.lastPktCorrectTime < 0 {
+            jitter.lastPktCorrectTime = 0
+        } else {
+            jitter.lastPktCorrectTime += RtmpDefaultFrameTimeMs
+        }
+        msg.Header.Timestamp = jitter.lastPktCorrectTime
+        jitter.lastPktTime = time
+        return
+    }
+
+    delta := time - jitter.lastPktTime
+
+    // the small backward jitter, keep the last time to be monotonically.
+    if delta < 0 && delta >= RtmpMaxJitterMsNeg {
+        delta = 0
+    }
+
+    // if jitter detected, reset the delta.
+    if delta < RtmpMaxJitterMsNeg || delta > RtmpMaxJitterMs {
+        // calc the right diff by audio sample rate
+        if msg.Header.IsAudio() && tba > 0 {
+            delta = int64(float64(delta) * 1000.0 / float64(tba))
+        } else if msg.Header.IsVideo() && tbv > 0 {
+            delta = int64(float64(delta) / float64(tbv))
+        } else {
+            delta = RtmpDefaultFrameTimeMs
+        }
+
+        // sometimes, the time is absolute time, so correct it again.
+        if delta < 0 || delta > RtmpMaxJitterMs {
+            delta = RtmpDefaultFrameTimeMs
+        }
+
+        logger.Info("jitter detected, last_pts=%v, pts=%v, diff=%v, last_time=%v, time=%v, diff=%v",
+            jitter.lastPktTime, time, time - jitter.lastPktTime, jitter.lastPktCorrectTime,
+            jitter.lastPktCorrectTime + delta, delta)
+    }
+
+    jitter.lastPktCorrectTime += delta
+
+    msg.Header.Timestamp = jitter.lastPktCorrectTime
+    jitter.lastPktTime = time
+}
+
+/**
+* reset for the stream republished, the timestamp of new stream restart,
+* the zero algorithm starts at zero again, the full algorithm continues the last time.
+*/
+func (jitter *RtmpJitter) Reset() {
+    jitter.started = false
+}
+
+// get current client time, the last packet time.
+func (jitter *RtmpJitter) Time() int64 {
+    return jitter.lastPktCorrectTime
+}
@@ -0,0 +1,156 @@
+/*
+The MIT License (MIT)
+
+Copyright (c) 2013-2014 winlin
+
+Permission is hereby granted, free of charge, to any person obtaining a copy of
+this software and associated documentation files (the "Software"), to deal in
+the Software without restriction, including without limitation the rights to
+use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+the Software, and to permit persons to whom the Software is furnished to do so,
+subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+*/
+
+package rtmp
+
+import (
+    "bytes"
+    "testing"
+    "github.com/cittu/go-srs/protocol"
+)
+
+// the recorded timeline of encoder, the type and timestamp of each message.
+type jitterPacket struct {
+    messageType int8
+    timestamp int64
+}
+
+func TestRtmpJitterCorrect(t *testing.T) {
+    const audio, video, data = protocol.RTMP_MSG_AudioMessage, protocol.RTMP_MSG_VideoMessage, protocol.RTMP_MSG_AMF0DataMessage
+
+    cases := []struct {
+        name string
+        ag int
+        tba, tbv int
+        packets []jitterPacket
+        expect []int64
+    }{
+        {"full monotonically", RtmpJitterFull, 0, 0,
+            []jitterPacket{{video, 0}, {video, 40}, {audio, 63}, {video, 80}},
+            []int64{0, 40, 63, 80}},
+        {"full small backward", RtmpJitterFull, 0, 0,
+            []jitterPacket{{video, 0}, {video, 80}, {video, 40}, {video, 120}},
+            []int64{0, 80, 80, 160}},
+        {"full large backward", RtmpJitterFull, 0, 0,
+            []jitterPacket{{video, 0}, {video, 40}, {video, 10040}, {video, 10080}, {video, 100}, {video, 140}},
+            []int64{0, 40, 50, 90, 100, 140}},
+        {"full large jump", RtmpJitterFull, 0, 0,
+            []jitterPacket{{video, 0}, {video, 40}, {video, 3600040}, {video, 3600080}},
+            []int64{0, 40, 50, 90}},
+        {"full start at absolute time", RtmpJitterFull, 0, 0,
+            []jitterPacket{{video, 1000000}, {video, 1000040}},
+            []int64{0, 40}},
+        {"full jump by frame rate", RtmpJitterFull, 0, 25,
+            []jitterPacket{{video, 0}, {video, 1000}},
+            []int64{0, 40}},
+        {"full jump by sample rate", RtmpJitterFull, 44100, 0,
+            []jitterPacket{{audio, 0}, {audio, 1000}},
+            []int64{0, 22}},
+        {"full metadata at zero", RtmpJitterFull, 0, 0,
+            []jitterPacket{{video, 0}, {video, 40}, {data, 40}, {video, 80}},
+            []int64{0, 40, 0, 80}},
+        {"zero start at zero", RtmpJitterZero, 0, 0,
+            []jitterPacket{{video, 1000}, {video, 1040}, {video, 1020}, {video, 9000}},
+            []int64{0, 40, 20, 8000}},
+        {"off keep timestamp", RtmpJitterOff, 0, 0,
+            []jitterPacket{{video, 1000}, {video, 960}, {video, 90000}},
+            []int64{1000, 960, 90000}},
+    }
+
+    logger := CreateLogger("test")
+    for _,c := range cases {
+        jitter := NewRtmpJitter()
+        for i,p := range c.packets {
+            msg := protocol.NewRtmpMessage()
+            msg.Header.MessageType = p.messageType
+            msg.Header.Timestamp = p.timestamp
+
+            jitter.Correct(msg, c.tba, c.tbv, c.ag, logger)
+            if msg.Header.Timestamp != c.expect[i] {
+                t.Errorf("%v: packet %v timestamp %v, expect %v, actual %v",
+                    c.name, i, p.timestamp, c.expect[i], msg.Header.Timestamp)
+            }
+        }
+    }
+}
+
+func TestRtmpJitterReset(t *testing.T) {
+    cases := []struct {
+        name string
+        ag int
+        expect []int64
+    }{
+        {"full continue", RtmpJitterFull, []int64{0, 40, 50, 90}},
+        {"zero restart", RtmpJitterZero, []int64{0, 40, 0, 40}},
+    }
+
+    logger := CreateLogger("test")
+    for _,c := range cases {
+        jitter := NewRtmpJitter()
+        for i,timestamp := range []int64{1000, 1040, 500, 540} {
+            // the stream republish.
+            if i == 2 {
+                jitter.Reset()
+            }
+
+            msg := protocol.NewRtmpMessage()
+            msg.Header.MessageType = protocol.RTMP_MSG_VideoMessage
+            msg.Header.Timestamp = timestamp
+            jitter.Correct(msg, 0, 0, c.ag, logger)
+            if msg.Header.Timestamp != c.expect[i] {
+                t.Errorf("%v: packet %v expect %v, actual %v", c.name, i, c.expect[i], msg.Header.Timestamp)
+            }
+        }
+    }
+
+    // the consumer reset the jitter and duration when publish again.
+    consumer := &RtmpConsumer{jitter: NewRtmpJitter(), firstTime: 100, unpublished: true}
+    consumer.jitter.started = true
+    consumer.onPublish()
+    if consumer.jitter.started || consumer.firstTime != -1 || consumer.unpublished {
+        t.Errorf("consumer must reset when publish again")
+    }
+}
+
+func TestRtmpCodecDemuxMetadata(t *testing.T) {
+    metadata := protocol.NewAmf0EcmaArray()
+    metadata.Set("framerate", protocol.Amf0Number(25))
+    metadata.Set("audiosamplerate", protocol.Amf0Number(44100))
+
+    b := &bytes.Buffer{}
+    protocol.EncodeAmf0String(b, "@setDataFrame")
+    protocol.EncodeAmf0String(b, "onMetaData")
+    protocol.EncodeAmf0Any(b, metadata)
+
+    codec := RtmpCodec{}
+    codec.demuxMetadata(b.Bytes())
+    if codec.FrameRate != 25 || codec.SampleRate != 44100 {
+        t.Errorf("metadata frame rate 25 and sample rate 44100, actual %v and %v", codec.FrameRate, codec.SampleRate)
+    }
+
+    // the sequence header overwrites the sample rate of metadata.
+    codec.demuxAudio([]byte{0xaf, 0, 0x12, 0x10})
+    if codec.SampleRate != 44100 || codec.FrameRate != 25 {
+        t.Errorf("aac sample rate 44100 and frame rate 25, actual %v and %v", codec.SampleRate, codec.FrameRate)
+    }
+}
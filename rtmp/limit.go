@@ -0,0 +1,221 @@
+/*
+The MIT License (MIT)
+
+Copyright (c) 2013-2014 winlin
+
+Permission is hereby granted, free of charge, to any person obtaining a copy of
+this software and associated documentation files (the "Software"), to deal in
+the Software without restriction, including without limitation the rights to
+use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+the Software, and to permit persons to whom the Software is furnished to do so,
+subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+*/
+
+package rtmp
+
+import (
+    "errors"
+    "sync"
+    "time"
+    "github.com/cittu/go-srs/protocol"
+    "github.com/cittu/go-srs/config"
+)
+
+var RtmpMaxConnections = errors.New("exceed max connections")
+var RtmpMaxIpConnections = errors.New("exceed max connections of ip")
+var RtmpIpRateLimited = errors.New("exceed connect rate of ip")
+var RtmpMaxVhostConnections = errors.New("exceed max connections of vhost")
+
+/**
+* the token bucket of ip for the connect rate,
+* refill rate tokens per minute, at most burst tokens.
+*/
+type connectBucket struct {
+    tokens float64
+    last time.Time
+}
+
+/**
+* the limiter of connections, the total and ip are checked when accept,
+* before handshake, while the vhost is checked when connect app.
+*/
+type connLimiter struct {
+    total int
+    ips map[string]int
+    vhosts map[string]int
+    // the vhost slot of connection, moved when the vhost override by stream.
+    slots map[*protocol.Conn]string
+    buckets map[string]*connectBucket
+    lastPrune time.Time
+    locker sync.Mutex
+}
+
+var limiter = &connLimiter{
+    ips: map[string]int{},
+    vhosts: map[string]int{},
+    slots: map[*protocol.Conn]string{},
+    buckets: map[string]*connectBucket{},
+}
+
+// take a token from the bucket of ip, false when rate limited.
+func (v *connLimiter) takeToken(ip string, rate, burst int) bool {
+    if rate <= 0 {
+        return true
+    }
+    if burst <= 0 {
+        burst = 1
+    }
+
+    now := time.Now()
+    v.prune(now, rate, burst)
+
+    b,ok := v.buckets[ip]
+    if !ok {
+        b = &connectBucket{tokens: float64(burst), last: now}
+        v.buckets[ip] = b
+    }
+    b.tokens += now.Sub(b.last).Minutes() * float64(rate)
+    if b.tokens > float64(burst) {
+        b.tokens = float64(burst)
+    }
+    b.last = now
+
+    if b.tokens < 1 {
+        return false
+    }
+    b.tokens--
+    return true
+}
+
+// remove the buckets which are full again, for they are the same as the new one.
+func (v *connLimiter) prune(now time.Time, rate, burst int) {
+    if now.Sub(v.lastPrune) < time.Minute {
+        return
+    }
+    v.lastPrune = now
+
+    full := time.Duration(float64(burst) / float64(rate) * float64(time.Minute))
+    for ip,b := range v.buckets {
+        if now.Sub(b.last) >= full {
+            delete(v.buckets, ip)
+        }
+    }
+}
+
+func (v *connLimiter) accept(ip string) (err error) {
+    c := config.Get()
+
+    v.locker.Lock()
+    defer v.locker.Unlock()
+
+    if max := c.MaxConnections(); max > 0 && v.total >= max {
+        return RtmpMaxConnections
+    }
+    if max := c.MaxConnectionsPerIp(); max > 0 && v.ips[ip] >= max {
+        return RtmpMaxIpConnections
+    }
+    // take the token last, the connection rejected by others never consume it.
+    if !v.takeToken(ip, c.IpConnectRate(), c.IpConnectBurst()) {
+        return RtmpIpRateLimited
+    }
+
+    v.total++
+    v.ips[ip]++
+    return
+}
+
+func (v *connLimiter) release(ip string) {
+    v.locker.Lock()
+    defer v.locker.Unlock()
+
+    v.total--
+    if v.ips[ip]--; v.ips[ip] <= 0 {
+        delete(v.ips, ip)
+    }
+}
+
+/**
+* acquire the slot of vhost for conn, move the slot when conn already in other vhost,
+* the slot is kept when failed.
+* @param max the max connections of vhost, 0 for no limit.
+* @return first whether the conn acquired the slot for the first time.
+*/
+func (v *connLimiter) acquireVhost(conn *protocol.Conn, vhost string, max int) (first bool, err error) {
+    v.locker.Lock()
+    defer v.locker.Unlock()
+
+    prev,ok := v.slots[conn]
+    if ok && prev == vhost {
+        return
+    }
+    if max > 0 && v.vhosts[vhost] >= max {
+        return false, RtmpMaxVhostConnections
+    }
+
+    v.vhosts[vhost]++
+    if ok {
+        v.decreaseVhost(prev)
+    }
+    v.slots[conn] = vhost
+    return !ok, nil
+}
+
+func (v *connLimiter) releaseVhost(conn *protocol.Conn) {
+    v.locker.Lock()
+    defer v.locker.Unlock()
+
+    if vhost,ok := v.slots[conn]; ok {
+        delete(v.slots, conn)
+        v.decreaseVhost(vhost)
+    }
+}
+
+func (v *connLimiter) decreaseVhost(vhost string) {
+    if v.vhosts[vhost]--; v.vhosts[vhost] <= 0 {
+        delete(v.vhosts, vhost)
+    }
+}
+
+/**
+* check the connection from ip before handshake,
+* by the max connections of server and ip, and the connect rate of ip.
+*/
+func (f *Factory) OnAccept(ip string) (err error) {
+    if err = limiter.accept(ip); err != nil {
+        protocol.ServerStat.OnRejected(ActionConnect, rejectReasons[err])
+    }
+    return
+}
+
+func (f *Factory) OnRelease(ip string) {
+    limiter.release(ip)
+}
+
+/**
+* check the max connections of vhost when connect app, or the vhost override by stream,
+* the slot is moved to the new vhost, and released when the connection closed.
+*/
+func checkVhostConnections(conn *protocol.Conn) (err error) {
+    vhost := conn.Request.Vhost
+
+    var first bool
+    if first,err = limiter.acquireVhost(conn, vhost, config.Get().VhostMaxConnections(vhost)); err != nil {
+        return
+    }
+    if first {
+        conn.OnClose(func() {
+            limiter.releaseVhost(conn)
+        })
+    }
+    return
+}
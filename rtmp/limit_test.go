@@ -0,0 +1,102 @@
+/*
+The MIT License (MIT)
+
+Copyright (c) 2013-2014 winlin
+
+Permission is hereby granted, free of charge, to any person obtaining a copy of
+this software and associated documentation files (the "Software"), to deal in
+the Software without restriction, including without limitation the rights to
+use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+the Software, and to permit persons to whom the Software is furnished to do so,
+subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+*/
+
+package rtmp
+
+import (
+    "testing"
+    "github.com/cittu/go-srs/config"
+    "github.com/cittu/go-srs/protocol"
+)
+
+func TestConnLimiterVhost(t *testing.T) {
+    v := &connLimiter{vhosts: map[string]int{}, slots: map[*protocol.Conn]string{}}
+    a, b := &protocol.Conn{}, &protocol.Conn{}
+
+    if first,err := v.acquireVhost(a, "x", 1); err != nil || !first {
+        t.Fatalf("acquire the first slot, first=%v, err is %v", first, err)
+    }
+    if _,err := v.acquireVhost(b, "x", 1); err != RtmpMaxVhostConnections {
+        t.Errorf("exceed max connections of vhost, err is %v", err)
+    }
+    if first,err := v.acquireVhost(a, "x", 1); err != nil || first {
+        t.Errorf("acquire the same vhost again, first=%v, err is %v", first, err)
+    }
+
+    // move the slot of a to y, which is full, the slot is kept.
+    if first,err := v.acquireVhost(b, "y", 1); err != nil || !first {
+        t.Fatalf("acquire y, first=%v, err is %v", first, err)
+    }
+    if _,err := v.acquireVhost(a, "y", 1); err != RtmpMaxVhostConnections || v.slots[a] != "x" || v.vhosts["x"] != 1 {
+        t.Errorf("keep the slot when move failed, err is %v, slot is %v", err, v.slots[a])
+    }
+
+    // move the slot of b to z, then a is able to move to y.
+    if first,err := v.acquireVhost(b, "z", 1); err != nil || first {
+        t.Errorf("move to z, first=%v, err is %v", first, err)
+    }
+    if _,err := v.acquireVhost(a, "y", 1); err != nil {
+        t.Errorf("move to y, err is %v", err)
+    }
+    if v.vhosts["x"] != 0 || v.vhosts["y"] != 1 || v.vhosts["z"] != 1 {
+        t.Errorf("the slots of vhosts %v", v.vhosts)
+    }
+
+    v.releaseVhost(a)
+    v.releaseVhost(b)
+    v.releaseVhost(b)
+    if len(v.vhosts) != 0 || len(v.slots) != 0 {
+        t.Errorf("release all slots, vhosts %v, slots %v", v.vhosts, v.slots)
+    }
+}
+
+func TestConnLimiterAcceptToken(t *testing.T) {
+    c,err := config.Parse("t.conf", []byte("max_connections_per_ip 1; ip_connect_rate 1; ip_connect_burst 2;"))
+    if err != nil {
+        t.Fatalf("parse config failed, err is %v", err)
+    }
+    defer config.Set(config.Get())
+    config.Set(c)
+
+    v := &connLimiter{ips: map[string]int{}, buckets: map[string]*connectBucket{}}
+    if err = v.accept("1.1.1.1"); err != nil {
+        t.Fatalf("accept the first connection, err is %v", err)
+    }
+
+    // rejected by the max connections of ip, the token is not consumed.
+    for i := 0; i < 3; i++ {
+        if err = v.accept("1.1.1.1"); err != RtmpMaxIpConnections {
+            t.Errorf("exceed max connections of ip, err is %v", err)
+        }
+    }
+
+    // the token left for the next connection.
+    v.release("1.1.1.1")
+    if err = v.accept("1.1.1.1"); err != nil {
+        t.Errorf("accept with the token left, err is %v", err)
+    }
+    v.release("1.1.1.1")
+    if err = v.accept("1.1.1.1"); err != RtmpIpRateLimited {
+        t.Errorf("the burst is consumed, err is %v", err)
+    }
+}
@@ -24,101 +24,301 @@ CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
 package rtmp
 
 import (
+    "io"
     "log"
     "os"
     "fmt"
+    "sync"
+    "time"
+    "bytes"
+    "strings"
+    "encoding/json"
+    "sync/atomic"
     "github.com/cittu/go-srs/core"
+    "github.com/cittu/go-srs/config"
 )
 
+// the tank of log.
+const (
+    LogTankConsole = "console"
+    LogTankFile = "file"
+)
+
+// the format of log.
+const (
+    LogFormatText = "text"
+    LogFormatJson = "json"
+)
+
+const (
+    logFormatText = iota
+    logFormatJson
+)
+
+// the format of all loggers, text or json.
+var logFormat int32 = logFormatText
+
+// set the format of all loggers, text or json.
+func SetLogFormat(format string) {
+    if format == LogFormatJson {
+        atomic.StoreInt32(&logFormat, logFormatJson)
+    } else {
+        atomic.StoreInt32(&logFormat, logFormatText)
+    }
+}
+
+// the level flag of all loggers, which can be changed at runtime, for example, reload.
+var logLevel int32 = core.Ltrace | core.Lwarn | core.Lerror
+
+// get the log flag of level, for example, the trace level enable trace, warn and error.
+func levelFlag(level string) int {
+    switch level {
+    case "info":
+        return core.Linfo | core.Ltrace | core.Lwarn | core.Lerror
+    case "warn":
+        return core.Lwarn | core.Lerror
+    case "error":
+        return core.Lerror
+    }
+    return core.Ltrace | core.Lwarn | core.Lerror
+}
+
+// set the level of all loggers, info, trace, warn or error.
+func SetLogLevel(level string) {
+    atomic.StoreInt32(&logLevel, int32(levelFlag(level)))
+}
+
+/**
+* the output of all loggers, write to console or file,
+* the output can be changed at runtime, for example, reload.
+*/
+type logWriter struct {
+    w io.Writer
+    // the opened log file, nil when write to console.
+    file *logFile
+    locker sync.RWMutex
+}
+
+func (o *logWriter) Write(p []byte) (n int, err error) {
+    o.locker.RLock()
+    defer o.locker.RUnlock()
+    return o.w.Write(p)
+}
+
+// the output of all loggers, default to console.
+var logOutput = &logWriter{w: os.Stdout}
+
+// set the output of all loggers to writer, for example, the buffer.
+func SetLogOutput(w io.Writer) {
+    logOutput.locker.Lock()
+    defer logOutput.locker.Unlock()
+
+    logOutput.close()
+    logOutput.w = w
+}
+
+/**
+* set the output of all loggers to console or file,
+* the previous log file is closed when changed.
+* @param tank the tank of log, console or file.
+* @param file the log file to append, ignored for console.
+* @param rotate the rotate config of log file, ignored for console.
+*/
+func SetLogTank(tank, file string, rotate LogRotate) (err error) {
+    var w io.Writer = os.Stdout
+    var f *logFile
+    if tank == LogTankFile {
+        if f,err = openLogFile(file, rotate); err != nil {
+            return
+        }
+        w = f
+    }
+
+    logOutput.locker.Lock()
+    defer logOutput.locker.Unlock()
+
+    logOutput.close()
+    logOutput.w = w
+    logOutput.file = f
+    return
+}
+
+// set the log format and output by config.
+func ApplyLogConfig(conf *config.Config) (err error) {
+    SetLogFormat(conf.LogFormat())
+    return SetLogTank(conf.LogTank(), conf.LogFile(), LogRotate{
+        MaxSize: conf.LogRotateMaxSize(),
+        Interval: conf.LogRotateInterval(),
+        Keep: conf.LogRotateKeep(),
+        Compress: conf.LogRotateCompress(),
+    })
+}
+
+// reopen the log file, for example, the log file moved by logrotate.
+func ReopenLog() (err error) {
+    logOutput.locker.RLock()
+    defer logOutput.locker.RUnlock()
+
+    if logOutput.file == nil {
+        return
+    }
+    return logOutput.file.Reopen()
+}
+
+// close the opened log file.
+func (o *logWriter) close() {
+    if o.file != nil {
+        o.file.Close()
+        o.file = nil
+    }
+}
+
+/**
+* the leveled logger, create by Factory.CreateLogger,
+* all loggers share the same level and output.
+*/
 type Logger struct {
+    // the component name, for example, conn.
+    Name string
     GoroutineId int
     Flag int
     Logger *log.Logger
+    // the context fields, for example, the ip and vhost of connection.
+    fields map[string]interface{}
+    locker sync.RWMutex
+}
+
+func (l *Logger) enabled(flag int) bool {
+    return int(atomic.LoadInt32(&logLevel))&flag != 0
+}
+
+// interface core.Logger
+func (l *Logger) SetField(name string, value interface{}) {
+    l.locker.Lock()
+    defer l.locker.Unlock()
+
+    if l.fields == nil {
+        l.fields = make(map[string]interface{})
+    }
+    l.fields[name] = value
+}
+
+// write the log in text or json format.
+func (l *Logger) output(level, msg string) {
+    if atomic.LoadInt32(&logFormat) != logFormatJson {
+        l.Logger.Output(3, "[" + level + "] " + msg)
+        return
+    }
+
+    record := map[string]interface{}{}
+    l.locker.RLock()
+    for k,v := range l.fields {
+        record[k] = v
+    }
+    l.locker.RUnlock()
+
+    record["time"] = time.Now().Format(time.RFC3339Nano)
+    record["level"] = level
+    record["name"] = l.Name
+    record["pid"] = os.Getpid()
+    record["id"] = l.GoroutineId
+    record["msg"] = strings.TrimRight(msg, "\n")
+
+    // the encoder append newline for each record.
+    var b bytes.Buffer
+    enc := json.NewEncoder(&b)
+    enc.SetEscapeHTML(false)
+    if err := enc.Encode(record); err != nil {
+        l.Logger.Output(3, "[error] marshal log failed, err is " + err.Error())
+        return
+    }
+    logOutput.Write(b.Bytes())
 }
 
 func (l *Logger) Info(format string, v ...interface{}) {
-    if l.Flag&core.Linfo != 0 {
-        l.Logger.Output(2, "[info] "+fmt.Sprintf(format, v...)+"\n")
+    if l.enabled(core.Linfo) {
+        l.output("info", fmt.Sprintf(format, v...))
     }
 }
 
 func (l *Logger) Trace(format string, v ...interface{}) {
-    if l.Flag&(core.Ltrace) != 0 {
-        l.Logger.Output(2, "[trace] "+fmt.Sprintf(format, v...)+"\n")
+    if l.enabled(core.Ltrace) {
+        l.output("trace", fmt.Sprintf(format, v...))
     }
 }
 
 func (l *Logger) Warn(format string, v ...interface{}) {
-    if l.Flag&core.Ltrace != 0 {
-        l.Logger.Output(2, "[warn] "+fmt.Sprintf(format, v...)+"\n")
+    if l.enabled(core.Lwarn) {
+        l.output("warn", fmt.Sprintf(format, v...))
     }
 }
 
 func (l *Logger) Error(format string, v ...interface{}) {
-    if l.Flag&core.Ltrace != 0 {
-        l.Logger.Output(2, "[error] "+fmt.Sprintf(format, v...)+"\n")
+    if l.enabled(core.Lerror) {
+        l.output("error", fmt.Sprintf(format, v...))
     }
 }
 
+// the log.Logger service, the Print* log at trace level.
 func (l *Logger) Print(v ...interface{}) {
-    if l.Flag&core.Ltrace != 0 {
-        l.Logger.Output(2, "[trace] "+fmt.Sprint(v...))
+    if l.enabled(core.Ltrace) {
+        l.output("trace", fmt.Sprint(v...))
     }
 }
 
 func (l *Logger) Printf(format string, v ...interface{}) {
-    if l.Flag&core.Ltrace != 0 {
-        l.Logger.Output(2, "[trace] "+fmt.Sprintf(format, v...))
+    if l.enabled(core.Ltrace) {
+        l.output("trace", fmt.Sprintf(format, v...))
     }
 }
 
 func (l *Logger) Println(v ...interface{}) {
-    if l.Flag&core.Ltrace != 0 {
-        l.Logger.Output(2, "[trace] "+fmt.Sprintln(v...))
+    if l.enabled(core.Ltrace) {
+        l.output("trace", fmt.Sprintln(v...))
     }
 }
 
 func (l *Logger) Fatal(v ...interface{}) {
-    if l.Flag&core.Lerror != 0 {
-        l.Logger.Output(2, "[error] " + fmt.Sprint(v...))
+    if l.enabled(core.Lerror) {
+        l.output("error", fmt.Sprint(v...))
     }
     os.Exit(1)
 }
 
 func (l *Logger) Fatalf(format string, v ...interface{}) {
-    if l.Flag&core.Lerror != 0 {
-        l.Logger.Output(2, "[error] "+fmt.Sprintf(format, v...))
+    if l.enabled(core.Lerror) {
+        l.output("error", fmt.Sprintf(format, v...))
     }
     os.Exit(1)
 }
 
 func (l *Logger) Fatalln(v ...interface{}) {
-    if l.Flag&core.Lerror != 0 {
-        l.Logger.Output(2, "[error] "+fmt.Sprintln(v...))
+    if l.enabled(core.Lerror) {
+        l.output("error", fmt.Sprintln(v...))
     }
     os.Exit(1)
 }
 
 func (l *Logger) Panic(v ...interface{}) {
-    s := "[error] " + fmt.Sprint(v...)
-    if l.Flag&core.Lerror != 0 {
-        l.Logger.Output(2, s)
+    s := fmt.Sprint(v...)
+    if l.enabled(core.Lerror) {
+        l.output("error", s)
     }
-    panic(s)
+    panic("[error] " + s)
 }
 
 func (l *Logger) Panicf(format string, v ...interface{}) {
-    s := "[error] "+fmt.Sprintf(format, v...)
-    if l.Flag&core.Lerror != 0 {
-        l.Logger.Output(2, s)
+    s := fmt.Sprintf(format, v...)
+    if l.enabled(core.Lerror) {
+        l.output("error", s)
     }
-    panic(s)
+    panic("[error] " + s)
 }
 
 func (l *Logger) Panicln(v ...interface{}) {
-    s := "[error] "+fmt.Sprintln(v...)
-    if l.Flag&core.Lerror != 0 {
-        l.Logger.Output(2, s)
+    s := fmt.Sprintln(v...)
+    if l.enabled(core.Lerror) {
+        l.output("error", s)
     }
-    panic(s)
+    panic("[error] " + s)
 }
@@ -0,0 +1,92 @@
+/*
+The MIT License (MIT)
+
+Copyright (c) 2013-2014 winlin
+
+Permission is hereby granted, free of charge, to any person obtaining a copy of
+this software and associated documentation files (the "Software"), to deal in
+the Software without restriction, including without limitation the rights to
+use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+the Software, and to permit persons to whom the Software is furnished to do so,
+subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+*/
+
+package rtmp
+
+import (
+    "runtime"
+    "github.com/cittu/go-srs/config"
+    "github.com/cittu/go-srs/core"
+)
+
+/**
+* the reload handler of rtmp,
+* apply the new config to the servers, loggers and sources.
+*/
+type ReloadHandler struct {
+    logger core.Logger
+}
+
+func NewReloadHandler() *ReloadHandler {
+    return &ReloadHandler{
+        logger: CreateLogger("reload"),
+    }
+}
+
+// interface config.ReloadHandler
+func (h *ReloadHandler) OnReloadListen() (err error) {
+    listens := config.Get().Listens()
+    h.logger.Trace("reload listen to %v", listens)
+    if err = Listen(listens); err != nil {
+        h.logger.Error("reload listen failed, err is %v", err)
+        return
+    }
+    return
+}
+
+func (h *ReloadHandler) OnReloadCpus() (err error) {
+    cpus := config.Get().Cpus()
+    h.logger.Trace("reload cpus to %v", cpus)
+    runtime.GOMAXPROCS(cpus)
+    return
+}
+
+func (h *ReloadHandler) OnReloadHttpApi() (err error) {
+    h.logger.Warn("http_api changed, ignored, restart to apply it")
+    return
+}
+
+func (h *ReloadHandler) OnReloadLogLevel() (err error) {
+    level := config.Get().LogLevel()
+    h.logger.Trace("reload log level to %v", level)
+    SetLogLevel(level)
+    return
+}
+
+func (h *ReloadHandler) OnReloadLogFile() (err error) {
+    conf := config.Get()
+    h.logger.Trace("reload log tank to %v, file is %v, format is %v", conf.LogTank(), conf.LogFile(), conf.LogFormat())
+    if err = ApplyLogConfig(conf); err != nil {
+        h.logger.Error("reload log tank failed, err is %v", err)
+        return
+    }
+    return
+}
+
+func (h *ReloadHandler) OnReloadVhost(vhost string) (err error) {
+    h.logger.Trace("reload vhost %v", vhost)
+    for _,source := range VhostSources(vhost) {
+        source.OnReloadVhost()
+    }
+    return
+}
@@ -0,0 +1,272 @@
+/*
+The MIT License (MIT)
+
+Copyright (c) 2013-2014 winlin
+
+Permission is hereby granted, free of charge, to any person obtaining a copy of
+this software and associated documentation files (the "Software"), to deal in
+the Software without restriction, including without limitation the rights to
+use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+the Software, and to permit persons to whom the Software is furnished to do so,
+subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+*/
+
+package rtmp
+
+import (
+    "compress/gzip"
+    "fmt"
+    "io"
+    "io/ioutil"
+    "os"
+    "path/filepath"
+    "regexp"
+    "sort"
+    "strconv"
+    "strings"
+    "sync"
+    "time"
+)
+
+// when rotate failed, retry after this interval, to not retry for each log.
+const logRotateRetryInterval = 10 * time.Second
+
+/**
+* the rotate config of log file.
+*/
+type LogRotate struct {
+    // rotate when the file exceed the size in bytes, 0 to disable.
+    MaxSize int64
+    // rotate when the file opened exceed the interval, 0 to disable.
+    Interval time.Duration
+    // the number of rotated files to keep, 0 to keep all.
+    Keep int
+    // whether gzip the rotated files.
+    Compress bool
+}
+
+/**
+* the log file which rotate by size or time,
+* the rotated file is renamed to file.yyyymmdd-hhmmss, and file.yyyymmdd-hhmmss.gz when compressed.
+*/
+type logFile struct {
+    path string
+    rotate LogRotate
+    f *os.File
+    size int64
+    opened time.Time
+    // the time to retry when rotate failed, zero to rotate when required.
+    retry time.Time
+    locker sync.Mutex
+    // serialize the compress and cleanup of rotated files.
+    cleanup sync.Mutex
+}
+
+func openLogFile(path string, rotate LogRotate) (v *logFile, err error) {
+    v = &logFile{path: path, rotate: rotate}
+    if err = v.open(); err != nil {
+        return nil, err
+    }
+    return
+}
+
+// open the file of path, close the current file when success, keep it when failed.
+func (v *logFile) open() (err error) {
+    var f *os.File
+    if f,err = os.OpenFile(v.path, os.O_WRONLY | os.O_CREATE | os.O_APPEND, 0644); err != nil {
+        return
+    }
+
+    var fi os.FileInfo
+    if fi,err = f.Stat(); err != nil {
+        f.Close()
+        return
+    }
+
+    if v.f != nil {
+        v.f.Close()
+    }
+    v.f = f
+    v.size = fi.Size()
+    v.opened = time.Now()
+    return
+}
+
+func (v *logFile) Write(p []byte) (n int, err error) {
+    v.locker.Lock()
+    defer v.locker.Unlock()
+
+    if v.needRotate(len(p)) {
+        // continue to write to the current file when rotate failed.
+        if err := v.doRotate(); err != nil {
+            v.retry = time.Now().Add(logRotateRetryInterval)
+            os.Stderr.WriteString("rotate log failed, err is " + err.Error() + "\n")
+        }
+    }
+
+    n,err = v.f.Write(p)
+    v.size += int64(n)
+    return
+}
+
+// open the file again, for external logrotate which moved the file,
+// keep writing to the current file when failed.
+func (v *logFile) Reopen() (err error) {
+    v.locker.Lock()
+    defer v.locker.Unlock()
+
+    return v.open()
+}
+
+func (v *logFile) Close() (err error) {
+    v.locker.Lock()
+    defer v.locker.Unlock()
+
+    return v.f.Close()
+}
+
+func (v *logFile) needRotate(n int) bool {
+    if v.size == 0 {
+        return false
+    }
+    if !v.retry.IsZero() && time.Now().Before(v.retry) {
+        return false
+    }
+    if v.rotate.MaxSize > 0 && v.size + int64(n) > v.rotate.MaxSize {
+        return true
+    }
+    if v.rotate.Interval > 0 && time.Now().Sub(v.opened) >= v.rotate.Interval {
+        return true
+    }
+    return false
+}
+
+// rename the current file and open a new one, compress and cleanup in background.
+func (v *logFile) doRotate() (err error) {
+    // use sequence when rotate multiple times in a second.
+    base := v.path + "." + time.Now().Format("20060102-150405")
+    rotated := base
+    for i := 1; fileExists(rotated) || fileExists(rotated + ".gz"); i++ {
+        rotated = fmt.Sprintf("%v.%v", base, i)
+    }
+
+    // rename the opened file, keep writing to it when open the new file failed.
+    if err = os.Rename(v.path, rotated); err != nil {
+        return
+    }
+    if err = v.open(); err != nil {
+        // rename back, to not lose the logs written to the opened file.
+        if err := os.Rename(rotated, v.path); err != nil {
+            os.Stderr.WriteString("rename log back failed, err is " + err.Error() + "\n")
+        }
+        return
+    }
+    v.retry = time.Time{}
+
+    go func(){
+        v.cleanup.Lock()
+        defer v.cleanup.Unlock()
+
+        if v.rotate.Compress {
+            compressFile(rotated)
+        }
+        v.removeExpired()
+    }()
+    return
+}
+
+// remove the oldest rotated files exceed the keep.
+func (v *logFile) removeExpired() {
+    if v.rotate.Keep <= 0 {
+        return
+    }
+
+    files := rotatedFiles(v.path)
+    for len(files) > v.rotate.Keep {
+        os.Remove(files[0].path)
+        files = files[1:]
+    }
+}
+
+// the rotated file, file.yyyymmdd-hhmmss[.seq][.gz]
+var rotatedName = regexp.MustCompile(`^(.+)\.(\d{8}-\d{6})(?:\.(\d+))?(?:\.gz)?$`)
+
+type rotatedFile struct {
+    path string
+    time time.Time
+    seq int
+}
+
+/**
+* get the rotated files of log file, sort by the time and sequence,
+* ignore the files not rotated by us, for example, file.bak.
+*/
+func rotatedFiles(path string) (files []rotatedFile) {
+    entries,err := ioutil.ReadDir(filepath.Dir(path))
+    if err != nil {
+        return
+    }
+
+    base := filepath.Base(path)
+    for _,entry := range entries {
+        matches := rotatedName.FindStringSubmatch(entry.Name())
+        if matches == nil || matches[1] != base || entry.IsDir() {
+            continue
+        }
+
+        t,err := time.ParseInLocation("20060102-150405", matches[2], time.Local)
+        if err != nil {
+            continue
+        }
+        seq,_ := strconv.Atoi(matches[3])
+        files = append(files, rotatedFile{path: filepath.Join(filepath.Dir(path), entry.Name()), time: t, seq: seq})
+    }
+
+    sort.Slice(files, func(i, j int) bool {
+        if !files[i].time.Equal(files[j].time) {
+            return files[i].time.Before(files[j].time)
+        }
+        return files[i].seq < files[j].seq
+    })
+    return
+}
+
+// gzip the file to file.gz, and remove the file.
+func compressFile(file string) (err error) {
+    var src, dst *os.File
+    if src,err = os.Open(file); err != nil {
+        return
+    }
+    defer src.Close()
+
+    if dst,err = os.OpenFile(file + ".gz", os.O_WRONLY | os.O_CREATE | os.O_TRUNC, 0644); err != nil {
+        return
+    }
+    defer dst.Close()
+
+    zw := gzip.NewWriter(dst)
+    zw.Name = filepath.Base(strings.TrimSuffix(file, ".gz"))
+    if _,err = io.Copy(zw, src); err != nil {
+        return
+    }
+    if err = zw.Close(); err != nil {
+        return
+    }
+
+    return os.Remove(file)
+}
+
+func fileExists(file string) bool {
+    _,err := os.Stat(file)
+    return err == nil
+}
@@ -0,0 +1,142 @@
+/*
+The MIT License (MIT)
+
+Copyright (c) 2013-2014 winlin
+
+Permission is hereby granted, free of charge, to any person obtaining a copy of
+this software and associated documentation files (the "Software"), to deal in
+the Software without restriction, including without limitation the rights to
+use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+the Software, and to permit persons to whom the Software is furnished to do so,
+subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+*/
+
+package rtmp
+
+import (
+    "io/ioutil"
+    "os"
+    "path/filepath"
+    "strings"
+    "testing"
+    "time"
+)
+
+func TestLogRemoveExpired(t *testing.T) {
+    dir,err := ioutil.TempDir("", "srs")
+    if err != nil {
+        t.Fatalf("create temp dir failed, err is %v", err)
+    }
+    defer os.RemoveAll(dir)
+
+    path := filepath.Join(dir, "srs.log")
+    for _,name := range []string{
+        "srs.log", "srs.log.bak", "srs.log.1", "other.log.20250101-000000",
+        "srs.log.20260102-000000.1", "srs.log.20251231-235959.gz", "srs.log.20260102-000000", "srs.log.20260101-120000.gz",
+    } {
+        if err = ioutil.WriteFile(filepath.Join(dir, name), nil, 0644); err != nil {
+            t.Fatalf("write %v failed, err is %v", name, err)
+        }
+    }
+
+    v := &logFile{path: path, rotate: LogRotate{Keep: 2}}
+    v.removeExpired()
+
+    var names []string
+    entries,_ := ioutil.ReadDir(dir)
+    for _,entry := range entries {
+        names = append(names, entry.Name())
+    }
+
+    // only the oldest rotated files are removed, sort by time and sequence.
+    expect := "other.log.20250101-000000 srs.log srs.log.1 srs.log.20260102-000000 srs.log.20260102-000000.1 srs.log.bak"
+    if v := strings.Join(names, " "); v != expect {
+        t.Errorf("expect files %v, actual %v", expect, v)
+    }
+}
+
+func TestLogReopenFailed(t *testing.T) {
+    dir,err := ioutil.TempDir("", "srs")
+    if err != nil {
+        t.Fatalf("create temp dir failed, err is %v", err)
+    }
+    defer os.RemoveAll(dir)
+
+    v,err := openLogFile(filepath.Join(dir, "logs", "srs.log"), LogRotate{})
+    if err == nil {
+        t.Fatalf("open log in not exists dir must fail")
+    }
+
+    os.Mkdir(filepath.Join(dir, "logs"), 0755)
+    if v,err = openLogFile(filepath.Join(dir, "logs", "srs.log"), LogRotate{}); err != nil {
+        t.Fatalf("open log failed, err is %v", err)
+    }
+    defer v.Close()
+
+    // the file moved and the dir removed, reopen failed.
+    os.Rename(filepath.Join(dir, "logs"), filepath.Join(dir, "moved"))
+    if err = v.Reopen(); err == nil {
+        t.Fatalf("reopen must fail")
+    }
+
+    // keep writing to the old file.
+    if _,err = v.Write([]byte("hello")); err != nil {
+        t.Errorf("write must success after reopen failed, err is %v", err)
+    }
+    if b,_ := ioutil.ReadFile(filepath.Join(dir, "moved", "srs.log")); string(b) != "hello" {
+        t.Errorf("write to the old file, actual %v", string(b))
+    }
+}
+
+func TestLogRotateFailedRetry(t *testing.T) {
+    dir,err := ioutil.TempDir("", "srs")
+    if err != nil {
+        t.Fatalf("create temp dir failed, err is %v", err)
+    }
+    defer os.RemoveAll(dir)
+
+    v,err := openLogFile(filepath.Join(dir, "srs.log"), LogRotate{MaxSize: 8})
+    if err != nil {
+        t.Fatalf("open log failed, err is %v", err)
+    }
+    defer v.Close()
+
+    // the file removed, rename failed when rotate.
+    v.Write([]byte("hello"))
+    os.Remove(filepath.Join(dir, "srs.log"))
+    if _,err = v.Write([]byte("world")); err != nil {
+        t.Errorf("write must success after rotate failed, err is %v", err)
+    }
+    if v.retry.IsZero() {
+        t.Fatalf("rotate must retry later when failed")
+    }
+    if v.needRotate(5) {
+        t.Errorf("rotate must not retry for each write")
+    }
+
+    // retry when the interval elapsed, and success.
+    v.retry = time.Now().Add(-1 * time.Second)
+    ioutil.WriteFile(filepath.Join(dir, "srs.log"), []byte("hello"), 0644)
+    if !v.needRotate(5) {
+        t.Fatalf("rotate must retry after interval")
+    }
+    if _,err = v.Write([]byte("world")); err != nil {
+        t.Errorf("write failed, err is %v", err)
+    }
+    if !v.retry.IsZero() {
+        t.Errorf("retry must be reset when rotate success")
+    }
+    if names := rotatedFiles(filepath.Join(dir, "srs.log")); len(names) != 1 {
+        t.Errorf("expect 1 rotated file, actual %v", names)
+    }
+}
@@ -26,8 +26,15 @@ package rtmp
 import (
     "github.com/cittu/go-srs/protocol"
     "github.com/cittu/go-srs/core"
+    "context"
+    "net"
+    "sync"
+    "time"
 )
 
+// the interval to sample the kbps and fps of connections and sources.
+const KbpsSampleInterval = 10 * time.Second
+
 var factory = newFactory()
 
 func newFactory() protocol.Factory {
@@ -42,3 +49,140 @@ func CreateLogger(name string) core.Logger {
 func ListenAndServe(addr string) error {
     return protocol.ListenAndServe(addr, factory)
 }
+
+// the serving rtmp servers, key is the listen address.
+var servers = map[string]*protocol.Server{}
+var serversLocker sync.Mutex
+
+/**
+* listen and serve at the addresses,
+* start the server for new address, and close the server not in addresses,
+* so it can be used for reload listen.
+* @remark the listen is synchronous, return error when any address failed to listen.
+*/
+func Listen(addrs []string) (err error) {
+    serversLocker.Lock()
+    defer serversLocker.Unlock()
+
+    wanted := map[string]bool{}
+    for _,addr := range addrs {
+        wanted[addr] = true
+        if _,ok := servers[addr]; ok {
+            continue
+        }
+
+        var ln net.Listener
+        if ln,err = net.Listen("tcp", addr); err != nil {
+            return
+        }
+
+        server := protocol.NewServer(addr, factory)
+        server.Logger.Trace("listen at %v ok", addr)
+        servers[addr] = server
+        go serve(server, ln)
+    }
+    samplerOnce.Do(func(){
+        go sampleKbps()
+    })
+
+    for addr,server := range servers {
+        if !wanted[addr] {
+            server.Logger.Trace("close server %v", addr)
+            server.Close()
+            delete(servers, addr)
+        }
+    }
+    return
+}
+
+func serve(server *protocol.Server, ln net.Listener) {
+    err := server.Serve(ln)
+    if err == protocol.RtmpServerClosed {
+        return
+    }
+    server.Logger.Error("serve rtmp at %v failed, err is %v", server.Addr, err)
+
+    // remove the failed server, to retry when reload.
+    serversLocker.Lock()
+    defer serversLocker.Unlock()
+    if servers[server.Addr] == server {
+        delete(servers, server.Addr)
+    }
+}
+
+// get the connections of all servers.
+func Conns() (v []*protocol.Conn) {
+    serversLocker.Lock()
+    defer serversLocker.Unlock()
+
+    for _,server := range servers {
+        v = append(v, server.Conns()...)
+    }
+    return
+}
+
+var samplerOnce sync.Once
+
+// sample the kbps of connections and sources, and the fps of sources, for the api.
+func sampleKbps() {
+    for range time.Tick(KbpsSampleInterval) {
+        for _,conn := range Conns() {
+            conn.Kbps.Sample()
+        }
+        for _,source := range Sources() {
+            source.sample()
+        }
+        protocol.ServerKbps.Sample()
+    }
+}
+
+/**
+* shutdown all servers gracefully,
+* stop accept new connections, notify the players the streams unpublished,
+* then close all connections and wait for them to quit until ctx done,
+* and wait for the http hooks of closed connections.
+*/
+func Shutdown(ctx context.Context) (err error) {
+    // take the servers out, to not block the reload and api in grace period.
+    var shutdowns []*protocol.Server
+    func() {
+        serversLocker.Lock()
+        defer serversLocker.Unlock()
+
+        for addr,server := range servers {
+            server.Close()
+            shutdowns = append(shutdowns, server)
+            delete(servers, addr)
+        }
+    }()
+
+    for _,source := range Sources() {
+        source.OnUnPublish()
+    }
+
+    // shutdown the servers in parallel, which share the same ctx.
+    var wg sync.WaitGroup
+    errs := make(chan error, len(shutdowns))
+    for _,server := range shutdowns {
+        wg.Add(1)
+        go func(server *protocol.Server) {
+            defer wg.Done()
+            if err := server.Shutdown(ctx); err != nil {
+                server.Logger.Warn("shutdown server %v failed, err is %v", server.Addr, err)
+                errs <- err
+            }
+        }(server)
+    }
+    wg.Wait()
+
+    close(errs)
+    for r := range errs {
+        err = r
+    }
+
+    // the connections quit, only wait for the hooks in grace period.
+    if r := waitHttpHooks(ctx); r != nil {
+        err = r
+    }
+    return
+}
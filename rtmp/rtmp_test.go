@@ -0,0 +1,137 @@
+/*
+The MIT License (MIT)
+
+Copyright (c) 2013-2014 winlin
+
+Permission is hereby granted, free of charge, to any person obtaining a copy of
+this software and associated documentation files (the "Software"), to deal in
+the Software without restriction, including without limitation the rights to
+use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+the Software, and to permit persons to whom the Software is furnished to do so,
+subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+*/
+
+package rtmp
+
+import (
+    "context"
+    "net"
+    "testing"
+    "time"
+    "github.com/cittu/go-srs/config"
+)
+
+// listen at a free port with the default config, return the address.
+func listenForTest(t *testing.T) string {
+    c,err := config.LoadDefault()
+    if err != nil {
+        t.Fatalf("load default config failed, err is %v", err)
+    }
+    config.Set(c)
+
+    ln,err := net.Listen("tcp", "127.0.0.1:0")
+    if err != nil {
+        t.Fatalf("listen failed, err is %v", err)
+    }
+    addr := ln.Addr().String()
+    ln.Close()
+
+    if err = Listen([]string{addr}); err != nil {
+        t.Fatalf("listen at %v failed, err is %v", addr, err)
+    }
+    return addr
+}
+
+// the client which connected but not handshake, keep the connection open.
+func dialForTest(t *testing.T, addr string) net.Conn {
+    c,err := net.Dial("tcp", addr)
+    if err != nil {
+        t.Fatalf("dial %v failed, err is %v", addr, err)
+    }
+
+    // wait for the server to accept it.
+    for i := 0; i < 100 && len(Conns()) == 0; i++ {
+        time.Sleep(10 * time.Millisecond)
+    }
+    if len(Conns()) != 1 {
+        t.Fatalf("server must accept the connection")
+    }
+    return c
+}
+
+func TestShutdownWaitConnections(t *testing.T) {
+    c := dialForTest(t, listenForTest(t))
+
+    ctx,cancel := context.WithTimeout(context.Background(), 10 * time.Second)
+    defer cancel()
+
+    done := make(chan error, 1)
+    go func() {
+        done <- Shutdown(ctx)
+    }()
+
+    // wait for the connection in grace period.
+    select {
+    case err := <-done:
+        t.Fatalf("shutdown must wait for the connection, err is %v", err)
+    case <-time.After(300 * time.Millisecond):
+    }
+
+    // the servers are not locked in grace period.
+    if v := Conns(); len(v) != 0 {
+        t.Errorf("servers must be removed when shutdown, actual %v conns", len(v))
+    }
+
+    // quit when the connection closed.
+    c.Close()
+    select {
+    case err := <-done:
+        if err != nil {
+            t.Errorf("shutdown must be graceful, err is %v", err)
+        }
+    case <-time.After(3 * time.Second):
+        t.Fatalf("shutdown must quit when connection closed")
+    }
+}
+
+func TestShutdownForceClose(t *testing.T) {
+    c := dialForTest(t, listenForTest(t))
+    defer c.Close()
+
+    ctx,cancel := context.WithTimeout(context.Background(), 300 * time.Millisecond)
+    defer cancel()
+
+    starttime := time.Now()
+    if err := Shutdown(ctx); err != context.DeadlineExceeded {
+        t.Errorf("shutdown must timeout, err is %v", err)
+    }
+    if d := time.Since(starttime); d < 300 * time.Millisecond {
+        t.Errorf("shutdown must wait until deadline, actual %v", d)
+    }
+
+    // the serving goroutine quit, which release the connection.
+    limiter.locker.Lock()
+    total := limiter.total
+    limiter.locker.Unlock()
+    if total != 0 {
+        t.Errorf("connection must quit when shutdown, actual %v conns", total)
+    }
+
+    // the connection is closed by server.
+    c.SetReadDeadline(time.Now().Add(3 * time.Second))
+    if _,err := c.Read(make([]byte, 1)); err == nil {
+        t.Errorf("connection must be closed by server")
+    } else if ne,ok := err.(net.Error); ok && ne.Timeout() {
+        t.Errorf("connection must be closed by server, err is %v", err)
+    }
+}
@@ -0,0 +1,252 @@
+/*
+The MIT License (MIT)
+
+Copyright (c) 2013-2014 winlin
+
+Permission is hereby granted, free of charge, to any person obtaining a copy of
+this software and associated documentation files (the "Software"), to deal in
+the Software without restriction, including without limitation the rights to
+use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+the Software, and to permit persons to whom the Software is furnished to do so,
+subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+*/
+
+package rtmp
+
+import (
+    "net"
+    "net/url"
+    "errors"
+    "strings"
+    "github.com/cittu/go-srs/protocol"
+    "github.com/cittu/go-srs/config"
+)
+
+var RtmpIpDenied = errors.New("ip denied")
+var RtmpRefererDenied = errors.New("referer denied")
+
+// the actions to authorize.
+const (
+    ActionConnect = "connect"
+    ActionPublish = "publish"
+    ActionPlay = "play"
+)
+
+// the reason of rejection, for the stat.
+var rejectReasons = map[error]string{
+    RtmpIpDenied: "ip_denied",
+    RtmpRefererDenied: "referer_denied",
+    RtmpTokenRequired: "token_required",
+    RtmpTokenExpired: "token_expired",
+    RtmpTokenInvalid: "token_invalid",
+    RtmpMaxConnections: "max_connections",
+    RtmpMaxIpConnections: "max_ip_connections",
+    RtmpIpRateLimited: "ip_rate_limited",
+    RtmpMaxVhostConnections: "max_vhost_connections",
+    RtmpOriginRejected: "origin_rejected",
+    RtmpOriginUnavailable: "origin_unavailable",
+    RtmpHookRejected: "hook_rejected",
+}
+
+/**
+* check the ip of client by the security rules of vhost,
+* the first matched rule is applied, allow when no rule matched.
+*/
+func checkIp(conn *protocol.Conn, action string) (err error) {
+    return checkVhostIp(conn.Request.Vhost, conn.Ip, action)
+}
+
+// check the ip by the security rules of vhost, for example, when vhost reloaded.
+func checkVhostIp(vhost, clientIp, action string) (err error) {
+    rules := config.Get().VhostSecurityRules(vhost)
+    if len(rules) == 0 {
+        return
+    }
+
+    ip := net.ParseIP(clientIp)
+    if ip == nil {
+        return RtmpIpDenied
+    }
+    for _,r := range rules {
+        if !r.Match(action, ip) {
+            continue
+        }
+        if !r.Allow {
+            return RtmpIpDenied
+        }
+        return
+    }
+    return
+}
+
+/**
+* check the referer(pageUrl) of client by the allowed domains of vhost,
+* the host of pageUrl must be the domain or its subdomain,
+* for example, the www.example.com matches the example.com.
+*/
+func checkReferer(conn *protocol.Conn, action string) (err error) {
+    req := &conn.Request
+    domains := config.Get().VhostRefer(req.Vhost, action)
+    if len(domains) == 0 {
+        return
+    }
+
+    var u *url.URL
+    if u,err = url.Parse(req.PageUrl); err != nil || u.Hostname() == "" {
+        return RtmpRefererDenied
+    }
+
+    host := strings.ToLower(u.Hostname())
+    for _,domain := range domains {
+        domain = strings.ToLower(domain)
+        if host == domain || strings.HasSuffix(host, "." + domain) {
+            return
+        }
+    }
+    return RtmpRefererDenied
+}
+
+/**
+* authorize the connect by the referer, max connections of vhost and on_connect hook,
+* reject the client by NetConnection.Connect.Rejected when failed.
+*/
+func authorizeConnect(conn *protocol.Conn) (err error) {
+    req, logger := &conn.Request, conn.Logger
+
+    if err = checkReferer(conn, ActionConnect); err == nil {
+        if err = checkVhostConnections(conn); err == nil {
+            err = onHttpHook(conn, HookOnConnect, nil)
+        }
+    }
+    if err != nil {
+        logger.Warn("reject connect %v from %v, pageUrl=%v, %v", req.TcUrl, conn.Ip, req.PageUrl, err)
+        protocol.ServerStat.OnRejected(ActionConnect, rejectReasons[err])
+        if err := conn.ResponseConnectReject(err.Error()); err != nil {
+            logger.Error("response connect reject failed.")
+        }
+        return
+    }
+    logger.Info("authorize connect success")
+    return
+}
+
+/**
+* when the vhost override by stream, authorize the client as connect to the new vhost,
+* by the referer, max connections, token traverse and on_connect hook of new vhost, then
+* the previous vhost is notified by on_close, the request is restored to previous when rejected.
+* @param prev the request before the stream parsed.
+*/
+func authorizeVhost(conn *protocol.Conn, prev *protocol.RtmpRequest, action string) (err error) {
+    req, logger := &conn.Request, conn.Logger
+    if req.Vhost == prev.Vhost {
+        return
+    }
+    logger.Trace("vhost override from %v to %v by stream", prev.Vhost, req.Vhost)
+
+    if err = checkReferer(conn, ActionConnect); err == nil {
+        if err = checkVhostConnections(conn); err == nil {
+            if err = tokenTraverse(conn); err == nil {
+                err = onHttpHook(conn, HookOnConnect, nil)
+            }
+        }
+    }
+    if err != nil {
+        logger.Warn("reject vhost %v from %v, %v", req.Vhost, conn.Ip, err)
+        protocol.ServerStat.OnRejected(action, rejectReasons[err])
+        // move the slot back to previous vhost, which is held by the conn, no limit.
+        limiter.acquireVhost(conn, prev.Vhost, 0)
+        *req = *prev
+        rejectStream(conn, action, err)
+        return
+    }
+
+    // the client leaves the previous vhost.
+    onHttpHookOf(conn, prev, HookOnClose, onCloseExtra(conn))
+    logger.Info("authorize vhost %v success", req.Vhost)
+    return
+}
+
+/**
+* reject the play by NetStream.Play.Failed,
+* or reject the publish by NetStream.Publish.Denied.
+*/
+func rejectStream(conn *protocol.Conn, action string, reason error) {
+    if action == ActionPublish {
+        if err := conn.OnStatusPublishDenied(conn.StreamId, reason.Error()); err != nil {
+            conn.Logger.Error("send onStatus(NetStream.Publish.Denied) message failed.")
+        }
+        return
+    }
+    if err := conn.OnStatusPlayFailed(conn.StreamId, reason.Error()); err != nil {
+        conn.Logger.Error("send onStatus(NetStream.Play.Failed) message failed.")
+    }
+}
+
+/**
+* check the ip, referer and token of client for the action,
+* @return the error when rejected, nil when allowed.
+*/
+func authorize(conn *protocol.Conn, action, secret string) (err error) {
+    if err = checkIp(conn, action); err != nil {
+        return
+    }
+    if err = checkReferer(conn, action); err != nil {
+        return
+    }
+    if secret != "" {
+        if err = checkToken(&conn.Request, secret); err != nil {
+            return
+        }
+    }
+    return
+}
+
+/**
+* authorize the publish by the ip, referer, publish token and on_publish hook,
+* reject the publisher by NetStream.Publish.Denied when failed.
+*/
+func authorizePublish(conn *protocol.Conn) (err error) {
+    req, logger := &conn.Request, conn.Logger
+
+    if err = authorize(conn, ActionPublish, config.Get().VhostPublishSecret(req.Vhost)); err == nil {
+        err = onHttpHook(conn, HookOnPublish, nil)
+    }
+    if err != nil {
+        logger.Warn("reject publish %v from %v, %v", req.StreamUrl(), conn.Ip, err)
+        protocol.ServerStat.OnRejected(ActionPublish, rejectReasons[err])
+        rejectStream(conn, ActionPublish, err)
+        return
+    }
+    logger.Info("authorize publish success")
+    return
+}
+
+/**
+* authorize the play by the ip, referer, play token and on_play hook,
+* reject the player by NetStream.Play.Failed when failed.
+*/
+func authorizePlay(conn *protocol.Conn) (err error) {
+    req, logger := &conn.Request, conn.Logger
+
+    if err = authorize(conn, ActionPlay, config.Get().VhostPlaySecret(req.Vhost)); err == nil {
+        err = onHttpHook(conn, HookOnPlay, nil)
+    }
+    if err != nil {
+        logger.Warn("reject play %v from %v, %v", req.StreamUrl(), conn.Ip, err)
+        protocol.ServerStat.OnRejected(ActionPlay, rejectReasons[err])
+        rejectStream(conn, ActionPlay, err)
+        return
+    }
+    logger.Info("authorize play success")
+    return
+}
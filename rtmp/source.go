@@ -25,23 +25,69 @@ package rtmp
 
 import (
     "github.com/cittu/go-srs/protocol"
+    "github.com/cittu/go-srs/config"
     "github.com/cittu/go-srs/core"
     "fmt"
     "sync"
+    "sync/atomic"
+    "time"
 )
 
+// the seed to generate the id of source.
+var sourceIdSeed int32
+
 type RtmpSource struct {
+    // the id of source, for the api to query the stream.
+    Id int
     Req *protocol.RtmpRequest
     Logger core.Logger
     SrsId int
     Consumers map[*protocol.Conn]*RtmpConsumer
     Locker sync.Mutex
+    // the time jitter algorithm for consumers.
+    JitterAlgorithm int
+    // the audio sample rate and video frame rate, parsed from metadata or sequence header,
+    // used by jitter to calc the delta, 0 if unknown.
+    SampleRate int
+    FrameRate int
+    // the max messages queued for paused consumer, drop the oldest when exceed.
+    QueueLength int
+    // the time the source created.
+    Created time.Time
+    // the bytes of stream, recv from publisher and send to consumers.
+    Kbps *protocol.Kbps
+    // the publisher and the time it started publishing, nil if not publishing.
+    publisher *protocol.Conn
+    publishTime time.Time
+    // the codec of stream, parsed from the sequence header.
+    codec RtmpCodec
+    // the metadata, the sequence headers and the last gop, sent to the new consumer first.
+    gop RtmpGopCache
+    metadata *protocol.RtmpMessage
+    videoSh *protocol.RtmpMessage
+    audioSh *protocol.RtmpMessage
+    // the video frames, and the fps between the last two samples.
+    frames int64
+    fps int
+    sampleTime time.Time
+    sampleFrames int64
+    // the connections which found the source, remove the source when all closed,
+    // protected by the sourcesLocker.
+    refs int
 }
 
 func NewRtmpSource(req *protocol.RtmpRequest, logger core.Logger) *RtmpSource {
+    // copy the request, for the request of client changes when republish.
+    r := *req
     v := &RtmpSource{
-        Req: req,
+        Id: int(atomic.AddInt32(&sourceIdSeed, 1)),
+        Req: &r,
         Logger: logger,
+        JitterAlgorithm: RtmpJitterFull,
+        QueueLength: config.DefaultQueueLength,
+        Created: time.Now(),
+        Kbps: protocol.NewKbps(),
+        sampleTime: time.Now(),
     }
     v.Consumers = make(map[*protocol.Conn]*RtmpConsumer)
     return v
@@ -55,9 +101,28 @@ func (source *RtmpSource) CreateConsumer(conn *protocol.Conn) *RtmpConsumer {
         source: source,
         conn: conn,
         logger: conn.Logger,
+        jitter: NewRtmpJitter(),
+        duration: conn.Request.Duration,
+        firstTime: -1,
     }
     source.Consumers[conn] = v
     source.Logger.Info("create consumer %v", v)
+
+    // fast startup, send the metadata, the sequence headers and the last gop.
+    cached := []*protocol.RtmpMessage{}
+    for _,msg := range []*protocol.RtmpMessage{source.metadata, source.videoSh, source.audioSh} {
+        if msg != nil {
+            cached = append(cached, msg)
+        }
+    }
+    cached = append(cached, source.gop.Messages()...)
+    for _,msg := range cached {
+        if err := v.Enqueue(msg); err != nil {
+            v.logger.Warn("enqueue cached msg failed, err is %v", err)
+            break
+        }
+    }
+    v.logger.Info("dump %v cached msgs, gop_cache=%v", len(cached), source.gop.Enabled())
     return v
 }
 
@@ -72,23 +137,199 @@ func (source *RtmpSource) DestroyConsumer(conn *protocol.Conn) {
 }
 
 func (source *RtmpSource) Initialize() (err error) {
+    source.applyConfig()
     return
 }
 
-func (source *RtmpSource) OnPublish(logger core.Logger, srsId int) (err error) {
-    source.Logger = logger
+// apply the vhost config to source.
+func (source *RtmpSource) applyConfig() {
+    conf := config.Get()
+    vhost := source.Req.Vhost
+
+    source.JitterAlgorithm = ParseJitterAlgorithm(conf.VhostTimeJitter(vhost))
+    source.QueueLength = conf.VhostQueueLength(vhost)
+    source.gop.Set(conf.VhostGopCache(vhost))
+}
+
+/**
+* when the vhost of source reloaded, apply the new config,
+* and apply the chunk size and security rules to the publisher and consumers.
+*/
+func (source *RtmpSource) OnReloadVhost() {
+    source.Locker.Lock()
+    defer source.Locker.Unlock()
+
+    source.applyConfig()
+    source.Logger.Trace("source %v reload vhost, jitter=%v, queue=%v",
+        source.Req.StreamUrl(), source.JitterAlgorithm, source.QueueLength)
+
+    // the publisher and consumers are alive when locked, for they are removed in the cleanup.
+    if source.publisher != nil {
+        source.applyConn(source.publisher, ActionPublish)
+    }
+    for conn := range source.Consumers {
+        source.applyConn(conn, ActionPlay)
+    }
+}
+
+// kick the client denied by the security rules, or set the chunk size of vhost.
+func (source *RtmpSource) applyConn(conn *protocol.Conn, action string) {
+    vhost := source.Req.Vhost
+    if err := checkVhostIp(vhost, conn.Ip, action); err != nil {
+        conn.Logger.Warn("kick %v client %v for vhost %v reloaded, %v", action, conn.Ip, vhost, err)
+        conn.Kick()
+        return
+    }
+
+    if chunkSize := config.Get().VhostChunkSize(vhost); chunkSize != conn.ChunkSize {
+        if err := conn.SetChunkSize(chunkSize); err != nil {
+            conn.Logger.Warn("reload chunk_size=%v failed, err is %v", chunkSize, err)
+            return
+        }
+        conn.Logger.Trace("reload chunk_size to %v", chunkSize)
+    }
+}
+
+func (source *RtmpSource) OnPublish(conn *protocol.Conn) (err error) {
+    source.Logger = conn.Logger
 
     // whatever, the publish thread is the source or edge source,
     // save its id to srouce id.
-    source.SourceId(srsId)
+    source.SourceId(conn.SrsId)
 
-    // TODO: FIXME: implements it.
+    // the consumers should be notified for the new unpublish.
+    source.Locker.Lock()
+    defer source.Locker.Unlock()
+
+    source.publisher = conn
+    source.publishTime = time.Now()
+    source.codec = RtmpCodec{}
+    source.SampleRate, source.FrameRate = 0, 0
+    source.clearCache()
+    for _,consumer := range source.Consumers {
+        consumer.onPublish()
+    }
 
     return
 }
 
+/**
+* when the publisher quit, or the server shutdown,
+* notify all consumers by NetStream.Play.UnpublishNotify.
+*/
 func (source *RtmpSource) OnUnPublish() {
-    // TODO: FIXME: implements it.
+    source.Locker.Lock()
+    defer source.Locker.Unlock()
+
+    source.publisher = nil
+    source.clearCache()
+
+    for _,consumer := range source.Consumers {
+        if err := consumer.onUnpublish(); err != nil {
+            consumer.logger.Warn("notify consumer unpublish failed, err is %v", err)
+        }
+    }
+}
+
+// get a copy of the request of source, safe in any goroutine.
+func (source *RtmpSource) Request() protocol.RtmpRequest {
+    source.Locker.Lock()
+    defer source.Locker.Unlock()
+
+    return *source.Req
+}
+
+// clear the gop cache and sequence headers, for the stream changed.
+func (source *RtmpSource) clearCache() {
+    source.gop.Clear()
+    source.metadata, source.videoSh, source.audioSh = nil, nil, nil
+}
+
+// get the number of messages and bytes in gop cache.
+func (source *RtmpSource) GopCacheSize() (msgs, bytes int) {
+    source.Locker.Lock()
+    defer source.Locker.Unlock()
+
+    return source.gop.Size()
+}
+
+// get the publisher and the time it started publishing, nil if not publishing.
+func (source *RtmpSource) Publisher() (conn *protocol.Conn, publishTime time.Time) {
+    source.Locker.Lock()
+    defer source.Locker.Unlock()
+
+    return source.publisher, source.publishTime
+}
+
+// get the number of consumers.
+func (source *RtmpSource) ConsumerCount() int {
+    source.Locker.Lock()
+    defer source.Locker.Unlock()
+
+    return len(source.Consumers)
+}
+
+/**
+* get the messages queued to send for all consumers,
+* the paused queue and the out channel of connection.
+*/
+func (source *RtmpSource) QueuedMessages() (n int) {
+    source.Locker.Lock()
+    defer source.Locker.Unlock()
+
+    for conn,consumer := range source.Consumers {
+        consumer.locker.Lock()
+        n += len(consumer.queue) + len(conn.OutChannel)
+        consumer.locker.Unlock()
+    }
+    return
+}
+
+// sample the kbps and fps, called by the sampler.
+func (source *RtmpSource) sample() {
+    source.Kbps.Sample()
+
+    source.Locker.Lock()
+    defer source.Locker.Unlock()
+
+    now := time.Now()
+    if ms := int64(now.Sub(source.sampleTime) / time.Millisecond); ms > 0 {
+        source.fps = int((source.frames - source.sampleFrames) * 1000 / ms)
+    }
+    source.sampleTime, source.sampleFrames = now, source.frames
+}
+
+// the video fps between the last two samples.
+func (source *RtmpSource) Fps() int {
+    source.Locker.Lock()
+    defer source.Locker.Unlock()
+
+    return source.fps
+}
+
+// get a copy of the codec of stream.
+func (source *RtmpSource) Codec() RtmpCodec {
+    source.Locker.Lock()
+    defer source.Locker.Unlock()
+
+    return source.codec
+}
+
+/**
+* stop the stream, kick the publisher and all consumers off,
+* they are notified by onStatus then disconnected.
+*/
+func (source *RtmpSource) Kick() {
+    source.Locker.Lock()
+    defer source.Locker.Unlock()
+
+    if source.publisher != nil {
+        source.publisher.Kick()
+    }
+    for conn,_ := range source.Consumers {
+        conn.Kick()
+    }
+    source.Logger.Trace("kick source %v, consumers=%v", source.Req.StreamUrl(), len(source.Consumers))
 }
 
 func (source *RtmpSource) SourceId(srsId int) {
@@ -105,6 +346,7 @@ func (source *RtmpSource) SourceId(srsId int) {
 func (source *RtmpSource) OnMessage(msg *protocol.RtmpMessage) (err error) {
     // for edge, directly proxy message to origin.
     // TODO: FIXME: implements it.
+    source.Kbps.AddRecvBytes(len(msg.Payload))
 
     // process audio packet
     if msg.Header.IsAudio() {
@@ -129,12 +371,61 @@ func (source *RtmpSource) OnMessage(msg *protocol.RtmpMessage) (err error) {
 
     // process onMetaData
     if msg.Header.IsAmf0Data() || msg.Header.IsAmf3Data() {
-        // TODO: FIXME: implements it.
+        if err = source.OnMetaData(msg); err != nil {
+            source.Logger.Error("source process onMetaData message failed")
+            return
+        }
+    }
+    return
+}
+
+/**
+* parse the metadata for the sample rate and frame rate,
+* cache the onMetaData for the new consumer and send to consumers.
+*/
+func (source *RtmpSource) OnMetaData(msg *protocol.RtmpMessage) (err error) {
+    source.Locker.Lock()
+    defer source.Locker.Unlock()
+
+    // skip 1bytes to decode the amf3 data.
+    b := msg.Payload
+    if msg.Header.IsAmf3Data() && len(b) > 0 {
+        b = b[1:]
+    }
+    b = source.codec.demuxMetadata(b)
+    source.SampleRate, source.FrameRate = source.codec.SampleRate, source.codec.FrameRate
+    source.Logger.Info("source metadata, sample_rate=%v, frame_rate=%v", source.SampleRate, source.FrameRate)
+    if b == nil {
+        return
+    }
+
+    // the player requires the onMetaData in amf0, without the @setDataFrame.
+    metadata := &protocol.RtmpMessage{Header: msg.Header, Payload: b}
+    metadata.Header.MessageType = protocol.RTMP_MSG_AMF0DataMessage
+    metadata.Header.PayloadLength = int32(len(b))
+    source.metadata = metadata
+
+    for _,consumer := range source.Consumers {
+        source.Logger.Info("enqueue metadata for consumer")
+        if err = consumer.Enqueue(metadata); err != nil {
+            return
+        }
     }
     return
 }
 
 func (source *RtmpSource) OnAudio(msg *protocol.RtmpMessage) (err error) {
+    source.Locker.Lock()
+    defer source.Locker.Unlock()
+
+    source.codec.demuxAudio(msg.Payload)
+    source.SampleRate = source.codec.SampleRate
+    if isAudioSequenceHeader(msg.Payload) {
+        source.audioSh = msg
+    } else {
+        source.gop.Cache(msg)
+    }
+
     for _,consumer := range source.Consumers {
         source.Logger.Info("enqueue audio for consumer")
         if err = consumer.Enqueue(msg); err != nil {
@@ -145,6 +436,17 @@ func (source *RtmpSource) OnAudio(msg *protocol.RtmpMessage) (err error) {
 }
 
 func (source *RtmpSource) OnVideo(msg *protocol.RtmpMessage) (err error) {
+    source.Locker.Lock()
+    defer source.Locker.Unlock()
+
+    source.codec.demuxVideo(msg.Payload)
+    source.frames++
+    if isVideoSequenceHeader(msg.Payload) {
+        source.videoSh = msg
+    } else {
+        source.gop.Cache(msg)
+    }
+
     for _,consumer := range source.Consumers {
         source.Logger.Info("enqueue video for consumer")
         if err = consumer.Enqueue(msg); err != nil {
@@ -154,12 +456,26 @@ func (source *RtmpSource) OnVideo(msg *protocol.RtmpMessage) (err error) {
     return
 }
 
+// enable or disable the gop cache, for example, the vhost of player changed.
 func (source *RtmpSource) GopCache(enabledCache bool) {
-    // TODO: FIXME: implements it.
+    source.Locker.Lock()
+    defer source.Locker.Unlock()
+
+    source.gop.Set(enabledCache)
 }
 
 var sources = map[string]*RtmpSource{}
-func FindSource(req *protocol.RtmpRequest, logger core.Logger) (source *RtmpSource, err error) {
+var sourcesLocker sync.Mutex
+
+/**
+* find or create the source of request for the conn,
+* the source is removed when all the connections which found it closed,
+* for the publisher and consumers are always the connections found it.
+*/
+func FindSource(conn *protocol.Conn, req *protocol.RtmpRequest, logger core.Logger) (source *RtmpSource, err error) {
+    sourcesLocker.Lock()
+    defer sourcesLocker.Unlock()
+
     url := req.StreamUrl()
 
     if _,ok := sources[url]; !ok {
@@ -175,8 +491,62 @@ func FindSource(req *protocol.RtmpRequest, logger core.Logger) (source *RtmpSour
     // for origin auth is on, the token in request maybe invalid,
     // and we only need to update the token of request, it's simple.
     source = sources[url]
+    source.Locker.Lock()
     source.Req.UpdateAuth(req)
+    source.Locker.Unlock()
+
+    source.refs++
+    conn.OnClose(func() {
+        releaseSource(source, logger)
+    })
+    return
+}
+
+// release the source when the conn which found it closed, remove it when no conn.
+func releaseSource(source *RtmpSource, logger core.Logger) {
+    sourcesLocker.Lock()
+    defer sourcesLocker.Unlock()
+
+    if source.refs--; source.refs > 0 {
+        return
+    }
+
+    url := source.Req.StreamUrl()
+    if sources[url] == source {
+        delete(sources, url)
+        logger.Info("remove source url=%s", url)
+    }
+}
+
+// get the source of request, nil if not found.
+func FetchSource(req *protocol.RtmpRequest) *RtmpSource {
+    sourcesLocker.Lock()
+    defer sourcesLocker.Unlock()
+
+    return sources[req.StreamUrl()]
+}
 
+// get all sources.
+func Sources() (v []*RtmpSource) {
+    sourcesLocker.Lock()
+    defer sourcesLocker.Unlock()
+
+    for _,source := range sources {
+        v = append(v, source)
+    }
+    return
+}
+
+// get the sources of vhost.
+func VhostSources(vhost string) (v []*RtmpSource) {
+    sourcesLocker.Lock()
+    defer sourcesLocker.Unlock()
+
+    for _,source := range sources {
+        if source.Request().Vhost == vhost {
+            v = append(v, source)
+        }
+    }
     return
 }
 
@@ -184,6 +554,23 @@ type RtmpConsumer struct {
     logger core.Logger
     source *RtmpSource
     conn *protocol.Conn
+    jitter *RtmpJitter
+    locker sync.Mutex
+    // when paused, the messages are queued and sent when unpaused.
+    paused bool
+    queue []*protocol.RtmpMessage
+    // whether the client disabled the audio or video by receiveAudio/receiveVideo.
+    audioDisabled bool
+    videoDisabled bool
+    // the duration in ms to play, stop when exceed, <=0 to play until unpublished.
+    // @see https://github.com/winlinvip/simple-rtmp-server/issues/45
+    duration float64
+    // the timestamp of first delivered media, -1 if not delivered.
+    firstTime int64
+    // whether the duration exceed and play stopped.
+    expired bool
+    // whether the unpublish notified, reset when publish again.
+    unpublished bool
 }
 
 func NewRtmpConsumer(source *RtmpSource, conn *protocol.Conn) *RtmpConsumer {
@@ -195,9 +582,166 @@ func (consumer *RtmpConsumer) String() string {
 }
 
 func (consumer *RtmpConsumer) Enqueue(msg *protocol.RtmpMessage) (err error) {
-    if err = consumer.conn.EnqueueSourceMessage(msg, consumer.conn.StreamId); err != nil {
+    consumer.locker.Lock()
+    defer consumer.locker.Unlock()
+
+    // drop all messages when play stopped for duration exceed.
+    if consumer.expired {
+        return
+    }
+
+    // filter the audio or video which client donot want to receive.
+    if msg.Header.IsAudio() && consumer.audioDisabled {
+        return
+    }
+    if msg.Header.IsVideo() && consumer.videoDisabled {
+        return
+    }
+
+    // the msg is shared by all consumers, copy it for jitter to correct.
+    msg = msg.Copy()
+
+    source := consumer.source
+    consumer.jitter.Correct(msg, source.SampleRate, source.FrameRate, source.JitterAlgorithm, consumer.logger)
+
+    // stop play when the delivered media exceed the duration.
+    if consumer.duration > 0 && (msg.Header.IsAudio() || msg.Header.IsVideo()) {
+        if consumer.firstTime < 0 {
+            consumer.firstTime = msg.Header.Timestamp
+        }
+        if float64(msg.Header.Timestamp - consumer.firstTime) >= consumer.duration {
+            return consumer.stop()
+        }
+    }
+
+    // hold the msg in queue when paused.
+    if consumer.paused {
+        if len(consumer.queue) >= source.QueueLength {
+            consumer.queue = consumer.queue[1:]
+            consumer.logger.Info("paused consumer drop the oldest msg for queue full")
+        }
+        consumer.queue = append(consumer.queue, msg)
+        return
+    }
+
+    // the slow player drop the message, which is not sent.
+    if err = consumer.conn.EnqueueSourceMessage(msg, consumer.conn.StreamId); err == protocol.RtmpOutChannelFull {
+        return nil
+    }
+    if err != nil {
         consumer.logger.Error("enqueue source message failed.")
         return
     }
+    source.Kbps.AddSendBytes(len(msg.Payload))
     return
 }
+
+/**
+* stop play for the duration exceed,
+* send the NetStream.Play.Stop and StreamEOF to client.
+*/
+func (consumer *RtmpConsumer) stop() (err error) {
+    conn := consumer.conn
+    consumer.expired = true
+    consumer.queue = nil
+    consumer.logger.Trace("stop play for duration exceed, duration=%.2f", consumer.duration)
+
+    // onStatus(NetStream.Play.Stop)
+    if err = conn.OnStatusPlayStop(conn.StreamId); err != nil {
+        consumer.logger.Error("send onStatus(NetStream.Play.Stop) message failed.")
+        return
+    }
+    consumer.logger.Info("send onStatus(NetStream.Play.Stop) message success.")
+
+    // StreamEOF
+    if err = conn.ResponseStreamEOF(conn.StreamId); err != nil {
+        consumer.logger.Error("send PCUC(StreamEOF) message failed.")
+        return
+    }
+    consumer.logger.Info("send PCUC(StreamEOF) message success.")
+
+    return
+}
+
+/**
+* when client send the pause message.
+* when paused, the messages are queued, and flushed when unpaused.
+* @param timeMs the time of stream when paused, or the time to resume when unpaused,
+*       the queued media before the resume time is dropped.
+*/
+func (consumer *RtmpConsumer) OnPlayClientPause(isPause bool, timeMs int64) (err error) {
+    consumer.locker.Lock()
+    defer consumer.locker.Unlock()
+
+    consumer.logger.Trace("stream consumer change pause state %v=>%v, time=%v", consumer.paused, isPause, timeMs)
+    consumer.paused = isPause
+    if isPause {
+        return
+    }
+
+    // flush the queued messages, from the resume time.
+    for _,msg := range consumer.queue {
+        if (msg.Header.IsAudio() || msg.Header.IsVideo()) && msg.Header.Timestamp < timeMs {
+            consumer.logger.Info("drop the paused msg before resume time, timestamp=%v", msg.Header.Timestamp)
+            continue
+        }
+        if err = consumer.conn.EnqueueSourceMessage(msg, consumer.conn.StreamId); err == protocol.RtmpOutChannelFull {
+            continue
+        }
+        if err != nil {
+            consumer.logger.Error("flush paused source message failed.")
+            return
+        }
+        consumer.source.Kbps.AddSendBytes(len(msg.Payload))
+    }
+    err = nil
+    consumer.queue = nil
+    return
+}
+
+// when the source publish again, the timestamp of stream restart.
+func (consumer *RtmpConsumer) onPublish() {
+    consumer.locker.Lock()
+    defer consumer.locker.Unlock()
+
+    consumer.unpublished = false
+    consumer.jitter.Reset()
+    consumer.firstTime = -1
+}
+
+// when the source unpublish, send the NetStream.Play.UnpublishNotify to client once.
+func (consumer *RtmpConsumer) onUnpublish() (err error) {
+    consumer.locker.Lock()
+    defer consumer.locker.Unlock()
+
+    if consumer.unpublished {
+        return
+    }
+    consumer.unpublished = true
+
+    conn := consumer.conn
+    if err = conn.OnStatusUnpublishNotify(conn.StreamId); err != nil {
+        consumer.logger.Error("send onStatus(NetStream.Play.UnpublishNotify) message failed.")
+        return
+    }
+    consumer.logger.Info("send onStatus(NetStream.Play.UnpublishNotify) message success.")
+    return
+}
+
+// when client send the receiveAudio message.
+func (consumer *RtmpConsumer) OnReceiveAudio(enabled bool) {
+    consumer.locker.Lock()
+    defer consumer.locker.Unlock()
+
+    consumer.logger.Trace("stream consumer receive audio %v", enabled)
+    consumer.audioDisabled = !enabled
+}
+
+// when client send the receiveVideo message.
+func (consumer *RtmpConsumer) OnReceiveVideo(enabled bool) {
+    consumer.locker.Lock()
+    defer consumer.locker.Unlock()
+
+    consumer.logger.Trace("stream consumer receive video %v", enabled)
+    consumer.videoDisabled = !enabled
+}
@@ -0,0 +1,109 @@
+/*
+The MIT License (MIT)
+
+Copyright (c) 2013-2014 winlin
+
+Permission is hereby granted, free of charge, to any person obtaining a copy of
+this software and associated documentation files (the "Software"), to deal in
+the Software without restriction, including without limitation the rights to
+use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+the Software, and to permit persons to whom the Software is furnished to do so,
+subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+*/
+
+package rtmp
+
+import (
+    "testing"
+    "github.com/cittu/go-srs/config"
+    "github.com/cittu/go-srs/protocol"
+)
+
+func TestSourceRemovedWhenReleased(t *testing.T) {
+    c,err := config.LoadDefault()
+    if err != nil {
+        t.Fatalf("load default config failed, err is %v", err)
+    }
+    config.Set(c)
+
+    logger := CreateLogger("test")
+    req := &protocol.RtmpRequest{Vhost: "__defaultVhost__", App: "live", Stream: "livestream"}
+
+    // the publisher and player found the same source.
+    var a, b *RtmpSource
+    if a,err = FindSource(&protocol.Conn{}, req, logger); err != nil {
+        t.Fatalf("find source failed, err is %v", err)
+    }
+    if b,err = FindSource(&protocol.Conn{}, req, logger); err != nil {
+        t.Fatalf("find source failed, err is %v", err)
+    }
+    if a != b || FetchSource(req) != a {
+        t.Fatalf("must find the same source")
+    }
+
+    // keep the source when any connection alive.
+    releaseSource(a, logger)
+    if FetchSource(req) != a {
+        t.Errorf("source must be kept when referenced")
+    }
+
+    // remove the source when all connections closed.
+    releaseSource(b, logger)
+    if FetchSource(req) != nil {
+        t.Errorf("source must be removed when released")
+    }
+
+    // create a new source for the same stream.
+    if b,err = FindSource(&protocol.Conn{}, req, logger); err != nil {
+        t.Fatalf("find source failed, err is %v", err)
+    }
+    defer releaseSource(b, logger)
+    if b == a {
+        t.Errorf("must create a new source")
+    }
+}
+
+func TestConsumerDropNotCounted(t *testing.T) {
+    c,err := config.LoadDefault()
+    if err != nil {
+        t.Fatalf("load default config failed, err is %v", err)
+    }
+    defer config.Set(config.Get())
+    config.Set(c)
+
+    logger := CreateLogger("test")
+    req := &protocol.RtmpRequest{Vhost: "__defaultVhost__", App: "live", Stream: "drop"}
+
+    // the player can only queue one message.
+    conn := &protocol.Conn{Logger: logger, OutChannel: make(chan *protocol.RtmpMessage, 1)}
+    source,err := FindSource(conn, req, logger)
+    if err != nil {
+        t.Fatalf("find source failed, err is %v", err)
+    }
+    defer releaseSource(source, logger)
+    consumer := source.CreateConsumer(conn)
+
+    for i := 0; i < 2; i++ {
+        msg := &protocol.RtmpMessage{Payload: make([]byte, 10)}
+        msg.Header.MessageType = protocol.RTMP_MSG_AudioMessage
+        msg.Header.Timestamp = int64(i * 20)
+        if err = consumer.Enqueue(msg); err != nil {
+            t.Fatalf("the dropped message must not fail, err is %v", err)
+        }
+    }
+
+    // only the queued message is counted.
+    if v := source.Kbps.SendBytes(); v != 10 {
+        t.Errorf("expect 10 bytes sent, actual %v", v)
+    }
+}
@@ -25,12 +25,15 @@ package rtmp
 
 import (
     "github.com/cittu/go-srs/protocol"
+    "github.com/cittu/go-srs/config"
     "errors"
     "net"
     "github.com/cittu/go-srs/core"
 )
 
 var FinalStage = errors.New("rtmp final stage")
+var RtmpVhostNotFound = errors.New("vhost not found")
+var RtmpVhostDisabled = errors.New("vhost disabled")
 
 /**
 * Helper functions for stage.
@@ -51,6 +54,89 @@ func identifyIgnoreMessage(msg *protocol.RtmpMessage, logger core.Logger) bool {
     return false
 }
 
+/**
+* resolve the vhost of request to the configed vhost,
+* the req.Vhost is set to the resolved vhost name, which is used to get the vhost config.
+* @return error when vhost not found or disabled.
+*/
+func resolveVhost(req *protocol.RtmpRequest, logger core.Logger) (err error) {
+    conf := config.Get()
+
+    vhost := conf.ResolveVhost(req.Vhost)
+    if vhost == nil {
+        logger.Error("vhost %v not found.", req.Vhost)
+        return RtmpVhostNotFound
+    }
+    logger.Info("vhost %v resolved to %v", req.Vhost, vhost.Arg0())
+    req.Vhost = vhost.Arg0()
+
+    if !conf.VhostEnabled(req.Vhost) {
+        logger.Error("vhost %v disabled.", req.Vhost)
+        return RtmpVhostDisabled
+    }
+
+    return
+}
+
+/**
+* attach the vhost, app and stream of request to the logger of connection,
+* and update the client info for api.
+*/
+func attachRequest(conn *protocol.Conn, clientType string) {
+    req, logger := &conn.Request, conn.Logger
+    conn.SetClientInfo(clientType)
+
+    logger.SetField("vhost", req.Vhost)
+    logger.SetField("app", req.App)
+    if req.Stream != "" {
+        logger.SetField("stream", req.Stream)
+    }
+}
+
+/**
+* parse the stream name of play or publish, the vhost maybe override by stream,
+* which must pass the connect checks of new vhost.
+* @remark the request is restored when failed.
+*/
+func parseStream(conn *protocol.Conn, streamName, clientType, action string) (err error) {
+    req, logger := &conn.Request, conn.Logger
+    prev := *req
+
+    if err = req.ParseStream(streamName, logger); err != nil {
+        logger.Error("parse stream name %v failed.", streamName)
+        *req = prev
+        return
+    }
+    // the vhost maybe override by stream, resolve it again.
+    if err = resolveVhost(req, logger); err != nil {
+        *req = prev
+        return
+    }
+    if err = authorizeVhost(conn, &prev, action); err != nil {
+        return
+    }
+    attachRequest(conn, clientType)
+    return
+}
+
+/**
+* set the out chunk size to the chunk size of vhost,
+* ignore when the chunk size not changed.
+*/
+func setChunkSize(conn *protocol.Conn, logger core.Logger) (err error) {
+    chunkSize := config.Get().VhostChunkSize(conn.Request.Vhost)
+    if chunkSize == conn.ChunkSize {
+        return
+    }
+
+    if err = conn.SetChunkSize(chunkSize); err != nil {
+        logger.Error("set chunk_size=%v failed, err is %v", chunkSize, err)
+        return
+    }
+    logger.Info("set chunk_size=%v success", chunkSize)
+    return
+}
+
 /**
 * the first stage, connect vhost/app.
 * @remark this stage only enter one time.
@@ -84,9 +170,6 @@ func (stage *connectStage) ConsumeMessage(msg *protocol.RtmpMessage) (err error)
         }
         logger.Info("rtmp connect app success")
 
-        // discovery vhost, resolve the vhost from config
-        // TODO: FIXME: implements it
-
         // check the request paramaters.
         if err = req.Validate(logger); err != nil {
             return
@@ -94,14 +177,28 @@ func (stage *connectStage) ConsumeMessage(msg *protocol.RtmpMessage) (err error)
         logger.Info("discovery app success. schema=%v, vhost=%v, port=%v, app=%v",
             req.Schema, req.Vhost, req.Port, req.App)
 
-        // check vhost
-        // TODO: FIXME: implements it
-        req.Vhost = "__defaultVhost__"
+        // discovery vhost, resolve the vhost from config, and check vhost
+        if err = resolveVhost(req, logger); err != nil {
+            if err := stage.conn.ResponseConnectReject(err.Error()); err != nil {
+                logger.Error("response connect reject failed.")
+            }
+            return
+        }
         logger.Info("check vhost success.")
+        attachRequest(stage.conn, protocol.RtmpClientUnknown)
 
         logger.Trace("connect app, tcUrl=%v, pageUrl=%v, swfUrl=%v, schema=%v, vhost=%v, port=%v, app=%v, args=%v",
             req.TcUrl, req.PageUrl, req.SwfUrl, req.Schema, req.Vhost, req.Port, req.App, req.FormatArgs())
 
+        // authorize the client by the referer and http hooks.
+        if err = authorizeConnect(stage.conn); err != nil {
+            return
+        }
+        conn := stage.conn
+        conn.OnClose(func(){
+            notifyHttpHook(conn, HookOnClose, onCloseExtra(conn))
+        })
+
         // show client identity
         si := SrsInfo{}
         si.Parse(req.Args)
@@ -122,6 +219,11 @@ func (stage *connectStage) ConsumeMessage(msg *protocol.RtmpMessage) (err error)
         }
         logger.Info("set peer bandwidth success")
 
+        // set chunk size to larger, the chunk size of vhost.
+        if err = setChunkSize(stage.conn, logger); err != nil {
+            return
+        }
+
         // get the ip which client connected.
         var iorw *net.TCPConn = stage.conn.IoRw
         localIp := iorw.LocalAddr().String()
@@ -131,7 +233,14 @@ func (stage *connectStage) ConsumeMessage(msg *protocol.RtmpMessage) (err error)
 
         // do token traverse before serve it.
         // @see https://github.com/cittu/simple-rtmp-server/pull/239
-        // TODO: FIXME: implements it
+        if err = tokenTraverse(stage.conn); err != nil {
+            logger.Warn("reject connect %v from %v by token traverse, %v", req.TcUrl, stage.conn.Ip, err)
+            protocol.ServerStat.OnRejected(ActionConnect, rejectReasons[err])
+            if err := stage.conn.ResponseConnectReject(err.Error()); err != nil {
+                logger.Error("response connect reject failed.")
+            }
+            return
+        }
 
         // response the client connect ok.
         if err = stage.conn.ResponseConnectApp(req.ObjectEncoding, localIp); err != nil {
@@ -193,12 +302,13 @@ func (stage *identifyClientStage) ConsumeMessage(msg *protocol.RtmpMessage) (err
         return
     case *protocol.RtmpPlayPacket:
         logger.Info("level0 identify client by play.")
-        logger.Info("identity client type=play, stream_name=%v, duration=%.2f", pkt.StreamName, pkt.Duration)
+        logger.Info("identity client type=play, stream_name=%v, start=%.2f, duration=%.2f", pkt.StreamName, pkt.Start, pkt.Duration)
 
         // use next stage.
         stage.conn.Stage = &playStage{
             conn: stage.conn,
             streamName: string(pkt.StreamName),
+            start: float64(pkt.Start),
             duration: float64(pkt.Duration),
         }
         // apply msg on next stage.
@@ -217,6 +327,10 @@ func (stage *identifyClientStage) ConsumeMessage(msg *protocol.RtmpMessage) (err
             streamName: string(pkt.StreamName),
         }
         return
+    case *protocol.RtmpCloseStreamPacket, *protocol.RtmpDeleteStreamPacket:
+        // the stream closed by client, for example, flash republish.
+        logger.Info("identify ignore closeStream/deleteStream message.")
+        return
     case *protocol.RtmpCallPacket:
         // call msg,
         // support response null first,
@@ -258,12 +372,13 @@ func (stage *identifyClientCreateStreamStage) ConsumeMessage(msg *protocol.RtmpM
 
     switch pkt := pkt.(type) {
     case *protocol.RtmpPlayPacket:
-        logger.Info("identity client type=play, stream_name=%v, duration=%.2f", pkt.StreamName, pkt.Duration)
+        logger.Info("identity client type=play, stream_name=%v, start=%.2f, duration=%.2f", pkt.StreamName, pkt.Start, pkt.Duration)
 
         // use next stage.
         stage.conn.Stage = &playStage{
             conn: stage.conn,
             streamName: string(pkt.StreamName),
+            start: float64(pkt.Start),
             duration: float64(pkt.Duration),
         }
         // apply msg on next stage.
@@ -276,7 +391,8 @@ func (stage *identifyClientCreateStreamStage) ConsumeMessage(msg *protocol.RtmpM
             conn: stage.conn,
             streamName: string(pkt.StreamName),
         }
-        return
+        // apply msg on next stage.
+        return stage.conn.Stage.ConsumeMessage(msg)
     case *protocol.RtmpCreateStreamPacket:
         logger.Info("identify client by create stream, play or flash publish.")
         return
@@ -292,6 +408,8 @@ func (stage *identifyClientCreateStreamStage) ConsumeMessage(msg *protocol.RtmpM
 type playStage struct {
     conn *protocol.Conn
     streamName string
+    // the start and duration in seconds of play command.
+    start float64
     duration float64
 }
 
@@ -301,26 +419,45 @@ func (stage *playStage) Cleanup() {
 func (stage *playStage) ConsumeMessage(msg *protocol.RtmpMessage) (err error) {
     req := &stage.conn.Request
     logger := stage.conn.Logger
-    logger.Trace("client identified, type=Play, stream_name=%s, duration=%.2f", stage.streamName, stage.duration)
+    logger.Trace("client identified, type=Play, stream_name=%s, start=%.2f, duration=%.2f", stage.streamName, stage.start, stage.duration)
+    if err = parseStream(stage.conn, stage.streamName, protocol.RtmpClientPlay, ActionPlay); err != nil {
+        return
+    }
 
-    // set chunk size to larger.
-    // TODO: FIXME: implements it.
-    chunkSize := 60000
-    if err = stage.conn.SetChunkSize(chunkSize); err != nil {
-        logger.Error("set chunk_size=%v failed.", chunkSize)
+    // authorize the play by the ip, referer, token and http hooks.
+    if err = authorizePlay(stage.conn); err != nil {
+        return
+    }
+
+    // the duration in play command is in seconds,
+    // the negative duration means play until the stream unpublished.
+    // @see https://github.com/winlinvip/simple-rtmp-server/issues/45
+    req.Duration = -1
+    if stage.duration > 0 {
+        req.Duration = stage.duration * 1000
+    }
+
+    // the start in play command is not supported, we only serve live stream,
+    // there is no recorded stream to seek, so always play the live.
+    if stage.start >= 0 {
+        logger.Warn("start=%.2f not supported, play the live stream.", stage.start)
+    }
+
+    // the vhost maybe changed by stream, reset the chunk size of vhost.
+    if err = setChunkSize(stage.conn, logger); err != nil {
         return
     }
-    logger.Info("set chunk_size=%v success", chunkSize)
 
     // find a source to serve.
     var source *RtmpSource
-    if source,err = FindSource(req, logger); err != nil {
+    if source,err = FindSource(stage.conn, req, logger); err != nil {
         return
     }
     core.AssertNotNil(source)
 
-    enabledCache := false
-    vhostIsEdge := false
+    conf := config.Get()
+    enabledCache := conf.VhostGopCache(req.Vhost)
+    vhostIsEdge := conf.VhostIsEdge(req.Vhost)
     logger.Trace("source url=%s, ip=%s, cache=%v, is_edge=%v, source_id=%d[%d]",
         req.StreamUrl(), stage.conn.IoRw.RemoteAddr().String(), enabledCache, vhostIsEdge, source.SrsId, source.SrsId)
     source.GopCache(enabledCache)
@@ -363,6 +500,10 @@ func (stage *playStage) ConsumeMessage(msg *protocol.RtmpMessage) (err error) {
     }
     logger.Info("send onStatus(NetStream.Data.Start) message failed")
 
+    // the player never send messages, but must receive messages in time.
+    stage.conn.SetTimeout(0, "")
+    stage.conn.SetSendTimeout(conf.VhostPlaySendTimeout(req.Vhost))
+
     logger.Info("start to play stream %v", stage.streamName)
     stage.conn.Stage = &playingStage{
         conn: stage.conn,
@@ -380,10 +521,100 @@ type playingStage struct {
 
 func (stage *playingStage) Cleanup() {
     stage.source.DestroyConsumer(stage.conn)
+    notifyHttpHook(stage.conn, HookOnStop, nil)
+}
+
+// when kicked, stop play by NetStream.Play.Stop and StreamEOF.
+func (stage *playingStage) OnKicked() (err error) {
+    conn := stage.conn
+    if err = conn.OnStatusPlayStop(conn.StreamId); err != nil {
+        conn.Logger.Error("send onStatus(NetStream.Play.Stop) message failed.")
+        return
+    }
+    if err = conn.ResponseStreamEOF(conn.StreamId); err != nil {
+        conn.Logger.Error("send PCUC(StreamEOF) message failed.")
+        return
+    }
+    conn.Logger.Info("kicked, send onStatus(NetStream.Play.Stop) and StreamEOF success.")
+    return
 }
 
 func (stage *playingStage) ConsumeMessage(msg *protocol.RtmpMessage) (err error) {
-    stage.conn.Logger.Info("playing got message %v", msg)
+    logger := stage.conn.Logger
+    logger.Info("playing got message %v", msg)
+
+    // only process the AMF0/AMF3 command message.
+    if !msg.Header.IsAmf0Command() && !msg.Header.IsAmf3Command() {
+        logger.Info("ignore all messages except amf0/amf3 command.")
+        return
+    }
+
+    var pkt protocol.RtmpPacket
+    if pkt,err = stage.conn.Protocol.DecodeMessage(msg); err != nil {
+        logger.Error("decode the amf0/amf3 command packet failed.")
+        return
+    }
+    logger.Info("decode the amf0/amf3 command packet success.")
+
+    switch pkt := pkt.(type) {
+    case *protocol.RtmpCloseStreamPacket, *protocol.RtmpDeleteStreamPacket:
+        // for jwplayer/flowplayer, which send close as pause message.
+        // @see https://github.com/winlinvip/simple-rtmp-server/issues/6
+        logger.Trace("player close stream, retry stream service.")
+        return protocol.RtmpControlRepublish
+    case *protocol.RtmpPausePacket:
+        return stage.onPause(bool(pkt.IsPause), float64(pkt.TimeMs))
+    case *protocol.RtmpReceiveAudioPacket:
+        stage.consumer.OnReceiveAudio(bool(pkt.BoolFlag))
+    case *protocol.RtmpReceiveVideoPacket:
+        stage.consumer.OnReceiveVideo(bool(pkt.BoolFlag))
+    default:
+        logger.Info("ignore AMF0/AMF3 command message.")
+    }
+
+    return
+}
+
+func (stage *playingStage) onPause(isPause bool, timeMs float64) (err error) {
+    logger := stage.conn.Logger
+    streamId := stage.conn.StreamId
+
+    if isPause {
+        // onStatus(NetStream.Pause.Notify)
+        if err = stage.conn.OnStatusPause(streamId, true); err != nil {
+            logger.Error("send onStatus(NetStream.Pause.Notify) message failed.")
+            return
+        }
+        logger.Info("send onStatus(NetStream.Pause.Notify) message success.")
+
+        // StreamEOF
+        if err = stage.conn.ResponseStreamEOF(streamId); err != nil {
+            logger.Error("send PCUC(StreamEOF) message failed.")
+            return
+        }
+        logger.Info("send PCUC(StreamEOF) message success.")
+    } else {
+        // onStatus(NetStream.Unpause.Notify)
+        if err = stage.conn.OnStatusPause(streamId, false); err != nil {
+            logger.Error("send onStatus(NetStream.Unpause.Notify) message failed.")
+            return
+        }
+        logger.Info("send onStatus(NetStream.Unpause.Notify) message success.")
+
+        // StreamBegin
+        if err = stage.conn.ResponseStreamBegin(streamId); err != nil {
+            logger.Error("send PCUC(StreamBegin) message failed.")
+            return
+        }
+        logger.Info("send PCUC(StreamBegin) message success.")
+    }
+
+    if err = stage.consumer.OnPlayClientPause(isPause, int64(timeMs)); err != nil {
+        logger.Error("consumer process play client pause failed.")
+        return
+    }
+    logger.Info("process pause success, is_pause=%v, time=%v.", isPause, timeMs)
+
     return
 }
 
@@ -403,19 +634,23 @@ func (stage *fmlePublishStage) ConsumeMessage(msg *protocol.RtmpMessage) (err er
     logger := stage.conn.Logger
     req := &stage.conn.Request
     logger.Trace("client identified, type=publish(FMLEPublish), stream_name=%s", stage.streamName)
+    if err = parseStream(stage.conn, stage.streamName, protocol.RtmpClientFmlePublish, ActionPublish); err != nil {
+        return
+    }
 
-    // set chunk size to larger.
-    // TODO: FIXME: implements it.
-    chunkSize := 60000
-    if err = stage.conn.SetChunkSize(chunkSize); err != nil {
-        logger.Error("set chunk_size=%v failed.", chunkSize)
+    // authorize the publish by the ip, referer, token and http hooks.
+    if err = authorizePublish(stage.conn); err != nil {
+        return
+    }
+
+    // the vhost maybe changed by stream, reset the chunk size of vhost.
+    if err = setChunkSize(stage.conn, logger); err != nil {
         return
     }
-    logger.Info("set chunk_size=%v success", chunkSize)
 
     // find a source to serve.
     var source *RtmpSource
-    if source,err = FindSource(req, logger); err != nil {
+    if source,err = FindSource(stage.conn, req, logger); err != nil {
         return
     }
     core.AssertNotNil(source)
@@ -423,8 +658,9 @@ func (stage *fmlePublishStage) ConsumeMessage(msg *protocol.RtmpMessage) (err er
     // check ASAP, to fail it faster if invalid.
     // TODO: FIXME: implements it.
 
-    enabledCache := false
-    vhostIsEdge := false
+    conf := config.Get()
+    enabledCache := conf.VhostGopCache(req.Vhost)
+    vhostIsEdge := conf.VhostIsEdge(req.Vhost)
     logger.Trace("source url=%s, ip=%s, cache=%v, is_edge=%v, source_id=%d[%d]",
         req.StreamUrl(), stage.conn.IoRw.RemoteAddr().String(), enabledCache, vhostIsEdge, source.SrsId, source.SrsId)
     source.GopCache(enabledCache)
@@ -518,12 +754,23 @@ type fmlePublishingStage struct {
 
 func (stage *fmlePublishingStage) Initialize() (err error) {
     stage.conn.Logger.Info("start to publishing stream")
-    stage.source.OnPublish(stage.conn.Logger, stage.conn.SrsId)
+
+    // the publisher must send the first media packet in time.
+    timeout := config.Get().VhostPublishFirstPacketTimeout(stage.conn.Request.Vhost)
+    stage.conn.SetTimeout(timeout, "publish first packet")
+
+    stage.source.OnPublish(stage.conn)
     return
 }
 
 func (stage *fmlePublishingStage) Cleanup() {
     stage.source.OnUnPublish()
+    notifyHttpHook(stage.conn, HookOnUnpublish, nil)
+}
+
+// when kicked, stop publish by NetStream.Unpublish.Success.
+func (stage *fmlePublishingStage) OnKicked() (err error) {
+    return onPublisherKicked(stage.conn)
 }
 
 func (stage *fmlePublishingStage) ConsumeMessage(msg *protocol.RtmpMessage) (err error) {
@@ -548,6 +795,7 @@ func (stage *fmlePublishingStage) ConsumeMessage(msg *protocol.RtmpMessage) (err
     }
 
     // video, audio, data message
+    onPublishMessage(stage.conn, msg)
     return stage.source.OnMessage(msg)
 }
 
@@ -565,21 +813,129 @@ func (stage *flashPublishStage) Cleanup() {
 
 func (stage *flashPublishStage) ConsumeMessage(msg *protocol.RtmpMessage) (err error) {
     logger := stage.conn.Logger
+    req := &stage.conn.Request
     logger.Trace("client identified, type=publish(FlashPublish), stream_name=%s", stage.streamName)
+    if err = parseStream(stage.conn, stage.streamName, protocol.RtmpClientFlashPublish, ActionPublish); err != nil {
+        return
+    }
 
-    // set chunk size to larger.
-    // TODO: FIXME: implements it.
-    chunkSize := 60000
-    if err = stage.conn.SetChunkSize(chunkSize); err != nil {
-        logger.Error("set chunk_size=%v failed.", chunkSize)
+    // authorize the publish by the ip, referer, token and http hooks.
+    if err = authorizePublish(stage.conn); err != nil {
         return
     }
-    logger.Info("set chunk_size=%v success", chunkSize)
 
-    // TODO: FIXME: implements it.
+    // the vhost maybe changed by stream, reset the chunk size of vhost.
+    if err = setChunkSize(stage.conn, logger); err != nil {
+        return
+    }
+
+    // find a source to serve.
+    var source *RtmpSource
+    if source,err = FindSource(stage.conn, req, logger); err != nil {
+        return
+    }
+    core.AssertNotNil(source)
+
+    conf := config.Get()
+    enabledCache := conf.VhostGopCache(req.Vhost)
+    vhostIsEdge := conf.VhostIsEdge(req.Vhost)
+    logger.Trace("source url=%s, ip=%s, cache=%v, is_edge=%v, source_id=%d[%d]",
+        req.StreamUrl(), stage.conn.IoRw.RemoteAddr().String(), enabledCache, vhostIsEdge, source.SrsId, source.SrsId)
+    source.GopCache(enabledCache)
+
+    // publish response onStatus(NetStream.Publish.Start)
+    if err = stage.conn.OnStatusPublish(stage.conn.StreamId); err != nil {
+        logger.Error("send onStatus(NetStream.Publish.Start) message failed")
+        return
+    }
+    logger.Info("send onStatus(NetStream.Publish.Start) message success.")
+
+    // enter publishing state.
+    nextStage := &flashPublishingStage{
+        conn: stage.conn,
+        source: source,
+    }
+    if err = nextStage.Initialize(); err != nil {
+        return
+    }
+    stage.conn.Stage = nextStage
+    return
+}
+
+/**
+* flash publishing stage
+ */
+type flashPublishingStage struct {
+    conn *protocol.Conn
+    source *RtmpSource
+}
+
+func (stage *flashPublishingStage) Initialize() (err error) {
+    stage.conn.Logger.Info("start to publishing stream")
+
+    // the publisher must send the first media packet in time.
+    timeout := config.Get().VhostPublishFirstPacketTimeout(stage.conn.Request.Vhost)
+    stage.conn.SetTimeout(timeout, "publish first packet")
+
+    stage.source.OnPublish(stage.conn)
     return
 }
 
+func (stage *flashPublishingStage) Cleanup() {
+    stage.source.OnUnPublish()
+    notifyHttpHook(stage.conn, HookOnUnpublish, nil)
+}
+
+// when kicked, stop publish by NetStream.Unpublish.Success.
+func (stage *flashPublishingStage) OnKicked() (err error) {
+    return onPublisherKicked(stage.conn)
+}
+
+// notify the publisher the stream is stopped by server.
+func onPublisherKicked(conn *protocol.Conn) (err error) {
+    if err = conn.OnStatusUnpublish(conn.StreamId); err != nil {
+        conn.Logger.Error("send onStatus(NetStream.Unpublish.Success) message failed.")
+        return
+    }
+    conn.Logger.Info("kicked, send onStatus(NetStream.Unpublish.Success) success.")
+    return
+}
+
+func (stage *flashPublishingStage) ConsumeMessage(msg *protocol.RtmpMessage) (err error) {
+    logger := stage.conn.Logger
+    logger.Info("flash publising stage consume msg %v", msg)
+
+    // process publish event.
+    if msg.Header.IsAmf3Command() || msg.Header.IsAmf0Command() {
+        // for flash, closeStream or deleteStream to stop publish.
+        var pkt protocol.RtmpPacket
+        if pkt,err = stage.conn.Protocol.DecodeMessage(msg); err != nil {
+            logger.Error("flash decode unpublish message failed")
+            return
+        }
+
+        switch pkt.(type) {
+        case *protocol.RtmpCloseStreamPacket, *protocol.RtmpDeleteStreamPacket:
+            logger.Trace("flash publish finished.")
+            return protocol.RtmpControlRepublish
+        }
+        logger.Trace("flash ignore AMF0/AMF3 command message.")
+        return
+    }
+
+    // video, audio, data message
+    onPublishMessage(stage.conn, msg)
+    return stage.source.OnMessage(msg)
+}
+
+// when publisher got media packet, the publisher must send next media packet in time.
+func onPublishMessage(conn *protocol.Conn, msg *protocol.RtmpMessage) {
+    if msg.Header.IsAudio() || msg.Header.IsVideo() {
+        timeout := config.Get().VhostPublishNormalTimeout(conn.Request.Vhost)
+        conn.SetTimeout(timeout, "publisher idle")
+    }
+}
+
 /**
 * the last stage close connection.
  */
@@ -0,0 +1,75 @@
+/*
+The MIT License (MIT)
+
+Copyright (c) 2013-2014 winlin
+
+Permission is hereby granted, free of charge, to any person obtaining a copy of
+this software and associated documentation files (the "Software"), to deal in
+the Software without restriction, including without limitation the rights to
+use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+the Software, and to permit persons to whom the Software is furnished to do so,
+subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+*/
+
+package rtmp
+
+import (
+    "fmt"
+    "time"
+    "errors"
+    "strconv"
+    "strings"
+    "crypto/hmac"
+    "crypto/sha256"
+    "encoding/hex"
+    "github.com/cittu/go-srs/protocol"
+)
+
+var RtmpTokenRequired = errors.New("token required")
+var RtmpTokenExpired = errors.New("token expired")
+var RtmpTokenInvalid = errors.New("token invalid")
+
+/**
+* sign the stream by secret, the token is the param of stream, for example:
+*       livestream?expire=1420041600&sign=xxx
+* where the sign is hex(hmac_sha256(secret, "vhost\napp\nstream\nexpire")),
+* the vhost is the configed vhost name, and the expire is the unix time in seconds.
+* @remark join by newline, which never in the url, for the app and stream may contain slash.
+*/
+func SignToken(secret, vhost, app, stream string, expire int64) string {
+    mac := hmac.New(sha256.New, []byte(secret))
+    fmt.Fprintf(mac, "%s\n%s\n%s\n%d", vhost, app, stream, expire)
+    return hex.EncodeToString(mac.Sum(nil))
+}
+
+// check the token in param of request, signed by secret.
+func checkToken(req *protocol.RtmpRequest, secret string) (err error) {
+    expire, sign := req.GetParam("expire"), req.GetParam("sign")
+    if expire == "" || sign == "" {
+        return RtmpTokenRequired
+    }
+
+    var v int64
+    if v,err = strconv.ParseInt(expire, 10, 64); err != nil {
+        return RtmpTokenInvalid
+    }
+    if time.Now().Unix() > v {
+        return RtmpTokenExpired
+    }
+
+    expected := SignToken(secret, req.Vhost, req.App, req.Stream, v)
+    if !hmac.Equal([]byte(expected), []byte(strings.ToLower(sign))) {
+        return RtmpTokenInvalid
+    }
+    return
+}
@@ -0,0 +1,62 @@
+/*
+The MIT License (MIT)
+
+Copyright (c) 2013-2014 winlin
+
+Permission is hereby granted, free of charge, to any person obtaining a copy of
+this software and associated documentation files (the "Software"), to deal in
+the Software without restriction, including without limitation the rights to
+use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+the Software, and to permit persons to whom the Software is furnished to do so,
+subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+*/
+
+package rtmp
+
+import (
+    "fmt"
+    "testing"
+    "time"
+    "github.com/cittu/go-srs/protocol"
+)
+
+func TestSignToken(t *testing.T) {
+    // the app and stream may contain slash, which must not be ambiguous.
+    if SignToken("secret", "vhost", "live/a", "b", 100) == SignToken("secret", "vhost", "live", "a/b", 100) {
+        t.Errorf("sign must not be ambiguous for slash")
+    }
+    if SignToken("secret", "vhost", "live", "a", 100) == SignToken("other", "vhost", "live", "a", 100) {
+        t.Errorf("sign must depends on secret")
+    }
+
+    expire := time.Now().Unix() + 60
+    sign := SignToken("secret", "vhost", "live", "a", expire)
+    cases := []struct {
+        name string
+        param string
+        err error
+    }{
+        {"valid", fmt.Sprintf("expire=%v&sign=%v", expire, sign), nil},
+        {"no sign", fmt.Sprintf("expire=%v", expire), RtmpTokenRequired},
+        {"no expire", fmt.Sprintf("sign=%v", sign), RtmpTokenRequired},
+        {"invalid expire", fmt.Sprintf("expire=x&sign=%v", sign), RtmpTokenInvalid},
+        {"expired", fmt.Sprintf("expire=100&sign=%v", SignToken("secret", "vhost", "live", "a", 100)), RtmpTokenExpired},
+        {"modified expire", fmt.Sprintf("expire=%v&sign=%v", expire + 1, sign), RtmpTokenInvalid},
+    }
+    for _,c := range cases {
+        req := &protocol.RtmpRequest{Vhost: "vhost", App: "live", Stream: "a", Param: c.param}
+        if err := checkToken(req, "secret"); err != c.err {
+            t.Errorf("%v: expect %v, actual %v", c.name, c.err, err)
+        }
+    }
+}
@@ -0,0 +1,173 @@
+/*
+The MIT License (MIT)
+
+Copyright (c) 2013-2014 winlin
+
+Permission is hereby granted, free of charge, to any person obtaining a copy of
+this software and associated documentation files (the "Software"), to deal in
+the Software without restriction, including without limitation the rights to
+use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+the Software, and to permit persons to whom the Software is furnished to do so,
+subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+*/
+
+package rtmp
+
+import (
+    "bytes"
+    "errors"
+    "net"
+    "net/url"
+    "sync"
+    "time"
+    "github.com/cittu/go-srs/protocol"
+    "github.com/cittu/go-srs/config"
+)
+
+var RtmpOriginRejected = errors.New("origin rejected")
+var RtmpOriginUnavailable = errors.New("origin unavailable")
+
+// the timeout to connect app of origin.
+const TokenTraverseTimeout = 3 * time.Second
+// the time to cache the connect accepted by origin.
+const TokenTraverseCacheTimeout = 30 * time.Second
+
+/**
+* the connect requests accepted by origin, to avoid traverse for each client,
+* the key is the tcUrl, pageUrl, swfUrl and args of request.
+*/
+type traverseCache struct {
+    expires map[string]time.Time
+    locker sync.Mutex
+}
+
+var traverseAccepted = &traverseCache{expires: map[string]time.Time{}}
+
+func (v *traverseCache) key(req *protocol.RtmpRequest) string {
+    b := &bytes.Buffer{}
+    b.WriteString(req.TcUrl + "\n" + req.PageUrl + "\n" + req.SwfUrl + "\n")
+    if req.Args != nil {
+        req.Args.Encode(b)
+    }
+    return b.String()
+}
+
+func (v *traverseCache) hit(key string) bool {
+    v.locker.Lock()
+    defer v.locker.Unlock()
+
+    expire,ok := v.expires[key]
+    return ok && time.Now().Before(expire)
+}
+
+func (v *traverseCache) accept(key string) {
+    v.locker.Lock()
+    defer v.locker.Unlock()
+
+    now := time.Now()
+    for k,expire := range v.expires {
+        if !now.Before(expire) {
+            delete(v.expires, k)
+        }
+    }
+    v.expires[key] = now.Add(TokenTraverseCacheTimeout)
+}
+
+/**
+* the request to connect origin, the vhost override by stream
+* is specified in the query of tcUrl, for example, rtmp://ip/live?vhost=demo.
+*/
+func originRequest(conn *protocol.Conn) *protocol.RtmpRequest {
+    r := conn.Request
+
+    _,_,vhost,_,_,_,err := protocol.DiscoveryTcUrl(r.TcUrl, conn.Logger)
+    if err != nil {
+        return &r
+    }
+    if d := config.Get().ResolveVhost(vhost); d != nil && d.Arg0() == r.Vhost {
+        return &r
+    }
+
+    var u *url.URL
+    if u,err = url.Parse(protocol.NormalizeQuery(r.TcUrl)); err != nil {
+        return &r
+    }
+    query := u.Query()
+    query.Set("vhost", r.Vhost)
+    u.RawQuery = query.Encode()
+    r.TcUrl = u.String()
+    return &r
+}
+
+/**
+* connect app of origin by the request of client,
+* @return RtmpOriginRejected when origin rejected, other error when origin unavailable.
+*/
+func connectOrigin(conn *protocol.Conn, origin string) (err error) {
+    logger := conn.Logger
+
+    var c net.Conn
+    if c,err = net.DialTimeout("tcp", origin, TokenTraverseTimeout); err != nil {
+        logger.Warn("connect origin %v failed, err is %v", origin, err)
+        return
+    }
+    defer c.Close()
+    c.SetDeadline(time.Now().Add(TokenTraverseTimeout))
+
+    client := protocol.NewRtmpClient(c, logger)
+    if err = client.Handshake(); err != nil {
+        logger.Warn("handshake with origin %v failed, err is %v", origin, err)
+        return
+    }
+
+    var description string
+    if description,err = client.ConnectApp(originRequest(conn)); err == protocol.RtmpConnectRejected {
+        logger.Warn("origin %v rejected, description=%v", origin, description)
+        return RtmpOriginRejected
+    } else if err != nil {
+        logger.Warn("connect app of origin %v failed, err is %v", origin, err)
+        return
+    }
+    return
+}
+
+/**
+* traverse the connect of client to origin, only accept the client when origin accepted,
+* try the next origin when unavailable, reject when all origins unavailable.
+* @see https://github.com/cittu/simple-rtmp-server/pull/239
+*/
+func tokenTraverse(conn *protocol.Conn) (err error) {
+    req := &conn.Request
+    c := config.Get()
+    if !c.VhostIsEdge(req.Vhost) || !c.VhostTokenTraverse(req.Vhost) {
+        return
+    }
+
+    key := traverseAccepted.key(originRequest(conn))
+    if traverseAccepted.hit(key) {
+        conn.Logger.Info("token traverse hit cache")
+        return
+    }
+
+    for _,origin := range c.VhostOrigins(req.Vhost) {
+        if err = connectOrigin(conn, origin); err == nil {
+            conn.Logger.Trace("token traverse to origin %v success", origin)
+            traverseAccepted.accept(key)
+            return
+        }
+        if err == RtmpOriginRejected {
+            return
+        }
+    }
+    return RtmpOriginUnavailable
+}
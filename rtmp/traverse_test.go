@@ -0,0 +1,227 @@
+/*
+The MIT License (MIT)
+
+Copyright (c) 2013-2014 winlin
+
+Permission is hereby granted, free of charge, to any person obtaining a copy of
+this software and associated documentation files (the "Software"), to deal in
+the Software without restriction, including without limitation the rights to
+use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+the Software, and to permit persons to whom the Software is furnished to do so,
+subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+*/
+
+package rtmp
+
+import (
+    "net"
+    "sync/atomic"
+    "testing"
+    "time"
+    "github.com/cittu/go-srs/config"
+    "github.com/cittu/go-srs/protocol"
+)
+
+/**
+* the fake origin, accept the connect app by _result,
+* or reject by _error with the description when reject specified.
+*/
+type fakeOrigin struct {
+    Factory
+    reject string
+    connects int32
+    addr string
+    server *protocol.Server
+}
+
+func startFakeOrigin(t *testing.T, reject string) *fakeOrigin {
+    ln,err := net.Listen("tcp", "127.0.0.1:0")
+    if err != nil {
+        t.Fatalf("listen failed, err is %v", err)
+    }
+
+    v := &fakeOrigin{reject: reject, addr: ln.Addr().String()}
+    v.server = protocol.NewServer(v.addr, v)
+    go v.server.Serve(ln)
+    return v
+}
+
+func (v *fakeOrigin) Close() {
+    v.server.Close()
+}
+
+func (v *fakeOrigin) Connects() int {
+    return int(atomic.LoadInt32(&v.connects))
+}
+
+func (v *fakeOrigin) NewConnectStage(conn *protocol.Conn) protocol.Stage {
+    return &fakeOriginStage{conn: conn, origin: v}
+}
+
+func (v *fakeOrigin) OnAccept(ip string) error {
+    return nil
+}
+
+func (v *fakeOrigin) OnRelease(ip string) {
+}
+
+type fakeOriginStage struct {
+    conn *protocol.Conn
+    origin *fakeOrigin
+}
+
+func (stage *fakeOriginStage) Cleanup() {
+}
+
+func (stage *fakeOriginStage) ConsumeMessage(msg *protocol.RtmpMessage) (err error) {
+    if !msg.Header.IsAmf0Command() {
+        return
+    }
+
+    var pkt protocol.RtmpPacket
+    if pkt,err = stage.conn.Protocol.DecodeMessage(msg); err != nil {
+        return
+    }
+    if _,ok := pkt.(*protocol.RtmpConnectAppPacket); !ok {
+        return
+    }
+
+    atomic.AddInt32(&stage.origin.connects, 1)
+    if stage.origin.reject != "" {
+        return stage.conn.ResponseConnectReject(stage.origin.reject)
+    }
+    return stage.conn.ResponseConnectApp(0, "127.0.0.1")
+}
+
+// the address which is unreachable, closed after listen.
+func unreachableAddr(t *testing.T) string {
+    ln,err := net.Listen("tcp", "127.0.0.1:0")
+    if err != nil {
+        t.Fatalf("listen failed, err is %v", err)
+    }
+    defer ln.Close()
+    return ln.Addr().String()
+}
+
+// use the edge vhost with token traverse to the origins, restore the config when test done.
+func traverseConfigForTest(t *testing.T, origins ...string) {
+    conf := "vhost __defaultVhost__ { mode remote; token_traverse on; origin"
+    for _,origin := range origins {
+        conf += " " + origin
+    }
+    conf += "; }"
+
+    c,err := config.Parse("t.conf", []byte(conf))
+    if err != nil {
+        t.Fatalf("parse config failed, err is %v", err)
+    }
+    prev := config.Get()
+    t.Cleanup(func(){
+        config.Set(prev)
+    })
+    config.Set(c)
+}
+
+// clear the accepted cache and use the origins, return the conn to traverse.
+func traverseForTest(t *testing.T, pageUrl string, origins ...string) *protocol.Conn {
+    traverseConfigForTest(t, origins...)
+
+    traverseAccepted.locker.Lock()
+    traverseAccepted.expires = map[string]time.Time{}
+    traverseAccepted.locker.Unlock()
+
+    conn := &protocol.Conn{Logger: CreateLogger("test")}
+    conn.Request = protocol.RtmpRequest{
+        TcUrl: "rtmp://127.0.0.1/live", PageUrl: pageUrl, Vhost: "__defaultVhost__", App: "live",
+    }
+    return conn
+}
+
+func TestTokenTraverseAccept(t *testing.T) {
+    origin := startFakeOrigin(t, "")
+    defer origin.Close()
+
+    // fall through the unreachable origin to the next.
+    conn := traverseForTest(t, "http://accept", unreachableAddr(t), origin.addr)
+    if err := tokenTraverse(conn); err != nil {
+        t.Fatalf("traverse must accept, err is %v", err)
+    }
+    if v := origin.Connects(); v != 1 {
+        t.Errorf("origin must be connected once, actual %v", v)
+    }
+
+    // the accepted is cached.
+    if err := tokenTraverse(conn); err != nil {
+        t.Errorf("traverse must accept by cache, err is %v", err)
+    }
+    if v := origin.Connects(); v != 1 {
+        t.Errorf("origin must not be connected when cache hit, actual %v", v)
+    }
+}
+
+func TestTokenTraverseReject(t *testing.T) {
+    rejecter, acceptor := startFakeOrigin(t, "invalid token"), startFakeOrigin(t, "")
+    defer rejecter.Close()
+    defer acceptor.Close()
+
+    // the description of _error is parsed by client.
+    c,err := net.Dial("tcp", rejecter.addr)
+    if err != nil {
+        t.Fatalf("dial origin failed, err is %v", err)
+    }
+    client := protocol.NewRtmpClient(c, CreateLogger("test"))
+    if err = client.Handshake(); err != nil {
+        t.Fatalf("handshake failed, err is %v", err)
+    }
+    description,err := client.ConnectApp(&protocol.RtmpRequest{TcUrl: "rtmp://127.0.0.1/live", App: "live"})
+    if err != protocol.RtmpConnectRejected || description != "invalid token" {
+        t.Errorf("connect must be rejected with description, actual %v, err is %v", description, err)
+    }
+    c.Close()
+
+    // never fall through to the next origin when rejected.
+    conn := traverseForTest(t, "http://reject", rejecter.addr, acceptor.addr)
+    if err = tokenTraverse(conn); err != RtmpOriginRejected {
+        t.Fatalf("traverse must reject, err is %v", err)
+    }
+    if v := acceptor.Connects(); v != 0 {
+        t.Errorf("must not connect next origin when rejected, actual %v", v)
+    }
+
+    // the rejected is not cached.
+    if err = tokenTraverse(conn); err != RtmpOriginRejected {
+        t.Errorf("traverse must reject again, err is %v", err)
+    }
+    if v := rejecter.Connects(); v != 3 {
+        t.Errorf("origin must be connected for each traverse, actual %v", v)
+    }
+}
+
+func TestTokenTraverseUnavailable(t *testing.T) {
+    conn := traverseForTest(t, "http://unavailable", unreachableAddr(t), unreachableAddr(t))
+    if err := tokenTraverse(conn); err != RtmpOriginUnavailable {
+        t.Fatalf("traverse must be unavailable, err is %v", err)
+    }
+
+    // the unavailable is not cached, accept when origin is up.
+    origin := startFakeOrigin(t, "")
+    defer origin.Close()
+
+    traverseConfigForTest(t, unreachableAddr(t), origin.addr)
+    if err := tokenTraverse(conn); err != nil {
+        t.Errorf("traverse must accept when origin is up, err is %v", err)
+    }
+    if v := origin.Connects(); v != 1 {
+        t.Errorf("origin must be connected once, actual %v", v)
+    }
+}
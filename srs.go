@@ -24,59 +24,206 @@ CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
 package main
 
 import (
-	"io"
+	"os"
 	"fmt"
+	"flag"
+	"context"
+	"strings"
 	"net/http"
-	"encoding/json"
+	"io/ioutil"
 	"runtime"
+	"syscall"
+	"os/signal"
 	"github.com/cittu/go-srs/core"
+	"github.com/cittu/go-srs/config"
 	"github.com/cittu/go-srs/rtmp"
+	"github.com/cittu/go-srs/api"
+)
+
+// the exit code of process, for systemd to restart it.
+const (
+	exitSuccess = 0
+	exitFailed = 1
+	// the flag package exit 2 when parse args failed.
+	exitUsage = 2
+)
+
+// the command line options.
+var (
+	confFile = flag.String("c", config.DefaultConfigFile, "the config file")
+	testConf = flag.Bool("t", false, "test the config file and exit")
+	showVersion = flag.Bool("v", false, "print the version and exit")
+	listen = flag.String("listen", "", "override the rtmp listen ports, split by comma, for example, 1935,1936")
+	apiListen = flag.String("api", "", "override the http api listen port, for example, 1986")
+	cpus = flag.Int("cpus", 0, "override the cpus to use")
+	logLevel = flag.String("log-level", "", "override the log level, info, trace, warn or error")
+	logFile = flag.String("log-file", "", "override the log file, and write log to file")
+	pidFile = flag.String("pid", "", "override the pid file")
 )
 
 func main() {
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %v [-c config] [-t] [-v] [options]\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() > 0 {
+		flag.Usage()
+		os.Exit(exitUsage)
+	}
+
+	if *showVersion {
+		fmt.Println(core.RTMP_SIG_SRS_VERSION)
+		os.Exit(exitSuccess)
+	}
+
 	fmt.Println("The golang for", core.SrsUrl)
 	fmt.Println(core.SrsSignature, fmt.Sprintf("%d.%d.%d",
 		core.Major, core.Minor, core.Revision), core.Copyright)
 
-	// TODO: FIXME: read and parse the config file.
+	// the command line options override the config file.
+	if *listen != "" {
+		config.SetOverride("listen", strings.Split(*listen, ",")...)
+	}
+	if *apiListen != "" {
+		config.SetOverride("http_api.listen", *apiListen)
+	}
+	if *cpus > 0 {
+		config.SetOverride("cpus", fmt.Sprint(*cpus))
+	}
+	if *logLevel != "" {
+		config.SetOverride("srs_log_level", *logLevel)
+	}
+	if *logFile != "" {
+		config.SetOverride("srs_log_tank", rtmp.LogTankFile)
+		config.SetOverride("srs_log_file", *logFile)
+	}
+	if *pidFile != "" {
+		config.SetOverride("pid", *pidFile)
+	}
+
+	// read and parse the config file,
+	// use the default config when the default file not exists.
+	conf, err := config.Load(*confFile)
+	if os.IsNotExist(err) && *confFile == config.DefaultConfigFile {
+		fmt.Println("Config", *confFile, "not found, use default config")
+		conf, err = config.LoadDefault()
+	}
+	if err != nil {
+		fmt.Println("Parse config failed, err is", err)
+		os.Exit(exitFailed)
+	}
+
+	if *testConf {
+		fmt.Println("Config", *confFile, "test is successful")
+		os.Exit(exitSuccess)
+	}
+	config.Set(conf)
+
+	if err := run(conf); err != nil {
+		fmt.Println("Serve failed, err is", err)
+		os.Exit(exitFailed)
+	}
+}
+
+func run(conf *config.Config) (err error) {
+	// the log format and output, console or file.
+	if err = rtmp.ApplyLogConfig(conf); err != nil {
+		return
+	}
+	defer rtmp.SetLogTank(rtmp.LogTankConsole, "", rtmp.LogRotate{})
 
 	// the factory to create objects.
+	rtmp.SetLogLevel(conf.LogLevel())
 	logger := rtmp.CreateLogger("srs")
-	logger.Trace("Use %d cpus for multiple processes", core.Cpus)
-	runtime.GOMAXPROCS(core.Cpus)
+	logger.Trace("Use %d cpus for multiple processes", conf.Cpus())
+	runtime.GOMAXPROCS(conf.Cpus())
 
-	logger.Trace("Rtmp listen at %v", core.ListenRtmp)
-	go func(){
-		if err := rtmp.ListenAndServe(fmt.Sprintf(":%d", core.ListenRtmp)); err != nil {
-			logger.Error("Serve RTMP failed, err is %v", err)
+	if file := conf.Pid(); file != "" {
+		if err = ioutil.WriteFile(file, []byte(fmt.Sprintf("%d\n", os.Getpid())), 0644); err != nil {
+			logger.Error("write pid file %v failed, err is %v", file, err)
 			return
 		}
+		defer os.Remove(file)
+		logger.Trace("write pid=%v to %v", os.Getpid(), file)
+	}
+
+	logger.Trace("Rtmp listen at %v", conf.Listens())
+	if err = rtmp.Listen(conf.Listens()); err != nil {
+		logger.Error("Serve RTMP failed, err is %v", err)
+		return
+	}
+
+	// reload the config when got SIGHUP.
+	config.Subscribe(rtmp.NewReloadHandler())
+	go func(){
+		signals := make(chan os.Signal, 1)
+		signal.Notify(signals, syscall.SIGHUP)
+		for range signals {
+			logger.Trace("Got SIGHUP, reload config")
+			if err := config.Reload(); err != nil {
+				logger.Error("Reload config failed, err is %v", err)
+			}
+		}
 	}()
 
-	http.HandleFunc("/api/v3/version", func(w http.ResponseWriter, req *http.Request) {
-		w.Header().Set("Server", fmt.Sprintf("CRS/%d.%d.%d",
-			core.Major, core.Minor, core.Revision))
-		w.Header().Set("Content-Type", "application/json")
-
-		data, err := json.Marshal(map[string]interface {}{
-			"code": 0,
-			"major": core.Major,
-			"minor": core.Minor,
-			"revision": core.Revision,
-		})
-		if err != nil {
-			logger.Error("marshal json failed, err is %v", err)
-			return
+	// reopen the log file when got SIGUSR1, for example, by logrotate.
+	go func(){
+		signals := make(chan os.Signal, 1)
+		signal.Notify(signals, syscall.SIGUSR1)
+		for range signals {
+			if err := rtmp.ReopenLog(); err != nil {
+				logger.Error("Reopen log failed, err is %v", err)
+				continue
+			}
+			logger.Trace("Got SIGUSR1, reopen log file")
 		}
+	}()
 
-		io.WriteString(w, string(data))
-	})
+	// the http api, serve in goroutine, quit when failed.
+	var apiServer *http.Server
+	apiErr := make(chan error, 1)
+	if conf.HttpApiEnabled() {
+		apiServer = &http.Server{Addr: conf.HttpApiListen()}
+		serveApi(apiServer, logger)
+		go func(){
+			apiErr <- apiServer.ListenAndServe()
+		}()
+	} else {
+		logger.Trace("Api disabled")
+	}
 
-	url := fmt.Sprintf("http://127.0.0.1:%d/api/v3/version", core.ListenApi)
-	logger.Trace("Api listen at %v, url is %v", core.ListenApi, url)
-	if err := http.ListenAndServe(fmt.Sprintf(":%d", core.ListenApi), nil); err != nil {
+	// quit when got SIGINT or SIGTERM.
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+	select {
+	case sig := <-signals:
+		logger.Trace("Got %v, graceful quit in %v", sig, config.Get().GracePeriod())
+	case err = <-apiErr:
 		logger.Error("Serve HTTP failed, err is %v", err)
 		return
 	}
+
+	// stop accept and wait for the connections to quit in grace period.
+	ctx, cancel := context.WithTimeout(context.Background(), config.Get().GracePeriod())
+	defer cancel()
+	if apiServer != nil {
+		if err := apiServer.Shutdown(ctx); err != nil {
+			logger.Warn("Shutdown HTTP failed, err is %v", err)
+		}
+	}
+	if err := rtmp.Shutdown(ctx); err != nil {
+		logger.Warn("Shutdown RTMP not graceful, err is %v", err)
+	}
+	logger.Trace("Quit")
+	return
 }
 
+// handle the http api.
+func serveApi(server *http.Server, logger core.Logger) {
+	server.Handler = api.NewHandler(logger)
+
+	addr := server.Addr
+	url := fmt.Sprintf("http://127.0.0.1:%v/api/v3/version", addr[strings.LastIndex(addr, ":") + 1:])
+	logger.Trace("Api listen at %v, url is %v", addr, url)
+}